@@ -0,0 +1,133 @@
+package authcookie
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	// CSRFCookie は JavaScript から読めるクッキー。同じ値を CSRFHeader に入れて送る（ダブルサブミット）
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// トークンのクッキーは API 以外のパスには送らない。CSRF トークンはフロントエンドから読めるよう全体に付ける
+const (
+	tokenCookiePath = "/api"
+	csrfCookiePath  = "/"
+)
+
+// Config はクッキー認証の設定。
+type Config struct {
+	Enabled  bool
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+var config Config
+var configOnce sync.Once
+
+// Current は初回呼び出し時に環境変数から設定を読み込む。
+//
+//	AUTH_COOKIE=on                クッキー認証を有効にする
+//	AUTH_COOKIE_DOMAIN            Domain 属性（未設定の場合は付けない）
+//	AUTH_COOKIE_SECURE=false      ローカルの http 環境でのみ使う
+//	AUTH_COOKIE_SAMESITE          lax（既定） / strict / none
+func Current() Config {
+	configOnce.Do(func() {
+		config = Config{
+			Enabled:  os.Getenv("AUTH_COOKIE") == "on",
+			Domain:   os.Getenv("AUTH_COOKIE_DOMAIN"),
+			Secure:   os.Getenv("AUTH_COOKIE_SECURE") != "false",
+			SameSite: http.SameSiteLaxMode,
+		}
+		switch strings.ToLower(os.Getenv("AUTH_COOKIE_SAMESITE")) {
+		case "strict":
+			config.SameSite = http.SameSiteStrictMode
+		case "none":
+			// SameSite=None は Secure が必須
+			config.SameSite = http.SameSiteNoneMode
+			config.Secure = true
+		}
+	})
+	return config
+}
+
+// SetTokens はアクセストークンとリフレッシュトークンを HttpOnly クッキーに入れ、
+// 新しい CSRF トークンを発行して返す。別オリジンのフロントエンドはクッキーを読めないため、
+// 返した CSRF トークンはレスポンスボディにも含める。
+func SetTokens(c *gin.Context, accessToken string, accessTTL time.Duration, refreshToken string, refreshTTL time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	csrfToken := hex.EncodeToString(b)
+
+	setCookie(c, AccessTokenCookie, accessToken, tokenCookiePath, accessTTL, true)
+	setCookie(c, RefreshTokenCookie, refreshToken, tokenCookiePath, refreshTTL, true)
+	setCookie(c, CSRFCookie, csrfToken, csrfCookiePath, refreshTTL, false)
+	return csrfToken, nil
+}
+
+// Clear は認証用のクッキーを全て削除する。
+func Clear(c *gin.Context) {
+	setCookie(c, AccessTokenCookie, "", tokenCookiePath, -1, true)
+	setCookie(c, RefreshTokenCookie, "", tokenCookiePath, -1, true)
+	setCookie(c, CSRFCookie, "", csrfCookiePath, -1, false)
+}
+
+// Token はクッキー認証が有効な場合に name のクッキーの値を返す。
+func Token(c *gin.Context, name string) string {
+	if !Current().Enabled {
+		return ""
+	}
+	value, err := c.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// VerifyCSRF は CSRFHeader の値が CSRFCookie と一致するかを確認する。
+// GET などの安全なメソッドは確認しない。
+func VerifyCSRF(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie, err := c.Cookie(CSRFCookie)
+	if err != nil || cookie == "" {
+		return false
+	}
+	header := c.GetHeader(CSRFHeader)
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
+func setCookie(c *gin.Context, name, value, path string, ttl time.Duration, httpOnly bool) {
+	cfg := Current()
+	maxAge := int(ttl.Seconds())
+	if ttl < 0 {
+		maxAge = -1
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   cfg.Domain,
+		MaxAge:   maxAge,
+		Secure:   cfg.Secure,
+		HttpOnly: httpOnly,
+		SameSite: cfg.SameSite,
+	})
+}
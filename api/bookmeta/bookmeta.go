@@ -0,0 +1,146 @@
+package bookmeta
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("bookmeta: metadata not found")
+
+// Metadata は ISBN から取得した書誌情報。取得できなかった項目はゼロ値のまま。
+type Metadata struct {
+	ISBN      string   `json:"isbn"`
+	Title     string   `json:"title"`
+	ImageURL  string   `json:"imageUrl"`
+	Authors   []string `json:"authors"`
+	Publisher string   `json:"publisher"`
+	// PublishedDate は YYYY / YYYY-MM / YYYY-MM-DD のいずれか
+	PublishedDate string `json:"publishedDate"`
+	PageCount     int    `json:"pageCount"`
+	Language      string `json:"language"`
+	Description   string `json:"description"`
+}
+
+// MetadataProvider は書誌情報の取得元を差し替えるためのインターフェース。
+// isbn13 は検証済みの ISBN-13。見つからない場合は ErrNotFound を返す。
+type MetadataProvider interface {
+	Lookup(ctx context.Context, isbn13 string) (*Metadata, error)
+}
+
+// NewProviderFromEnv は BOOK_METADATA_PROVIDERS（カンマ区切り、既定 openbd,googlebooks）の順に問い合わせる
+// MetadataProvider を返す。指定できる値は次のとおり。
+//
+//	openbd        openBD（BOOK_METADATA_OPENBD_URL で接続先を変更できる）
+//	googlebooks   Google Books API（GOOGLE_BOOKS_API_KEY があれば付与する）
+//	fixture       BOOK_METADATA_FIXTURE_DIR 配下の <ISBN-13>.json を返す。オフラインのテスト用
+func NewProviderFromEnv() MetadataProvider {
+	names := os.Getenv("BOOK_METADATA_PROVIDERS")
+	if names == "" {
+		names = "openbd,googlebooks"
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	chain := Chain{}
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "openbd":
+			chain = append(chain, &OpenBDProvider{BaseURL: os.Getenv("BOOK_METADATA_OPENBD_URL"), HTTPClient: client})
+		case "googlebooks":
+			chain = append(chain, &GoogleBooksProvider{BaseURL: os.Getenv("BOOK_METADATA_GOOGLE_BOOKS_URL"), APIKey: os.Getenv("GOOGLE_BOOKS_API_KEY"), HTTPClient: client})
+		case "fixture":
+			chain = append(chain, &FixtureProvider{Dir: os.Getenv("BOOK_METADATA_FIXTURE_DIR")})
+		}
+	}
+	if len(chain) == 1 {
+		return chain[0]
+	}
+	return chain
+}
+
+// Chain は先頭から順に問い合わせ、最初に見つかった書誌情報を返す。
+// 通信エラーなどで問い合わせられなかったものがあり、どれからも見つからなかった場合はそのエラーを返す。
+type Chain []MetadataProvider
+
+func (c Chain) Lookup(ctx context.Context, isbn13 string) (*Metadata, error) {
+	var firstErr error
+	for _, provider := range c {
+		metadata, err := provider.Lookup(ctx, isbn13)
+		if err == nil {
+			return metadata, nil
+		}
+		if !errors.Is(err, ErrNotFound) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, ErrNotFound
+}
+
+// normalizeDate は 20070401 / 200704 / 2007-04-01 / 2007/04 などを YYYY / YYYY-MM / YYYY-MM-DD に揃える。
+// 解釈できない場合は空文字を返す。
+func normalizeDate(s string) string {
+	digits := strings.NewReplacer("-", "", "/", "", ".", "").Replace(strings.TrimSpace(s))
+	layouts := map[int][2]string{
+		4: {"2006", "2006"},
+		6: {"200601", "2006-01"},
+		8: {"20060102", "2006-01-02"},
+	}
+	layout, ok := layouts[len(digits)]
+	if !ok {
+		return ""
+	}
+	t, err := time.Parse(layout[0], digits)
+	if err != nil {
+		return ""
+	}
+	return t.Format(layout[1])
+}
+
+// iso639_2 は ONIX の3文字の言語コードのうち、2文字のコードがあるもの
+var iso639_2 = map[string]string{
+	"jpn": "ja",
+	"eng": "en",
+	"chi": "zh",
+	"zho": "zh",
+	"kor": "ko",
+	"fre": "fr",
+	"fra": "fr",
+	"ger": "de",
+	"deu": "de",
+	"spa": "es",
+	"ita": "it",
+	"rus": "ru",
+}
+
+func normalizeLanguage(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if code, ok := iso639_2[s]; ok {
+		return code
+	}
+	return s
+}
+
+// maxResponseSize は書誌情報 API のレスポンスとして読み込む上限
+const maxResponseSize = 1 << 20
+
+// NormalizeAuthorNames は前後の空白を除いて連続する空白を1つにまとめ、空の名前と重複を取り除く。順序は保つ。
+// 取得した書誌情報とリクエストで指定された著者名の両方に使う。
+func NormalizeAuthorNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	result := []string{}
+	for _, name := range names {
+		name = strings.Join(strings.Fields(name), " ")
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	return result
+}
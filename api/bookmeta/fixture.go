@@ -0,0 +1,35 @@
+package bookmeta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// FixtureProvider は Dir 配下の <ISBN-13>.json（Metadata の JSON）を返す。
+// 外部 API に接続できないローカル開発とテスト用。
+type FixtureProvider struct {
+	Dir string
+}
+
+func (p *FixtureProvider) Lookup(ctx context.Context, isbn13 string) (*Metadata, error) {
+	data, err := os.ReadFile(filepath.Join(p.Dir, isbn13+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+	metadata.ISBN = isbn13
+	metadata.PublishedDate = normalizeDate(metadata.PublishedDate)
+	metadata.Language = normalizeLanguage(metadata.Language)
+	metadata.Authors = NormalizeAuthorNames(metadata.Authors)
+	return &metadata, nil
+}
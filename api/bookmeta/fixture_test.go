@@ -0,0 +1,71 @@
+package bookmeta
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFixtureProvider(t *testing.T) {
+	provider := &FixtureProvider{Dir: "testdata"}
+
+	got, err := provider.Lookup(context.Background(), "9784101001616")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	want := &Metadata{
+		ISBN:          "9784101001616",
+		Title:         "羅生門・鼻",
+		ImageURL:      "https://example.com/covers/9784101001616.jpg",
+		Authors:       []string{"芥川 龍之介"},
+		Publisher:     "新潮社",
+		PublishedDate: "2005-01",
+		PageCount:     192,
+		Language:      "ja",
+		Description:   "王朝物の短編集",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := provider.Lookup(context.Background(), "9780000000002"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestChainReturnsFirstFound(t *testing.T) {
+	unavailable := errors.New("unavailable")
+	fixture := &FixtureProvider{Dir: "testdata"}
+
+	tests := []struct {
+		name    string
+		chain   Chain
+		wantErr error
+	}{
+		{"found after not found", Chain{&FixtureProvider{Dir: t.TempDir()}, fixture}, nil},
+		{"found after error", Chain{failingProvider{unavailable}, fixture}, nil},
+		{"not found", Chain{&FixtureProvider{Dir: t.TempDir()}}, ErrNotFound},
+		{"error and not found", Chain{failingProvider{unavailable}, &FixtureProvider{Dir: t.TempDir()}}, unavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := tt.chain.Lookup(context.Background(), "9784101001616")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && metadata.Title != "羅生門・鼻" {
+				t.Errorf("got %+v", metadata)
+			}
+		})
+	}
+}
+
+type failingProvider struct {
+	err error
+}
+
+func (p failingProvider) Lookup(ctx context.Context, isbn13 string) (*Metadata, error) {
+	return nil, p.err
+}
@@ -0,0 +1,90 @@
+package bookmeta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultGoogleBooksURL = "https://www.googleapis.com/books/v1"
+
+// GoogleBooksProvider は Google Books API から書誌情報を取得する。
+type GoogleBooksProvider struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+type googleBooksResponse struct {
+	TotalItems int `json:"totalItems"`
+	Items      []struct {
+		VolumeInfo struct {
+			Title         string   `json:"title"`
+			Subtitle      string   `json:"subtitle"`
+			Authors       []string `json:"authors"`
+			Publisher     string   `json:"publisher"`
+			PublishedDate string   `json:"publishedDate"`
+			Description   string   `json:"description"`
+			PageCount     int      `json:"pageCount"`
+			Language      string   `json:"language"`
+			ImageLinks    struct {
+				Thumbnail string `json:"thumbnail"`
+			} `json:"imageLinks"`
+		} `json:"volumeInfo"`
+	} `json:"items"`
+}
+
+func (p *GoogleBooksProvider) Lookup(ctx context.Context, isbn13 string) (*Metadata, error) {
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = defaultGoogleBooksURL
+	}
+
+	query := url.Values{"q": {"isbn:" + isbn13}}
+	if p.APIKey != "" {
+		query.Set("key", p.APIKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/volumes?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient(p.HTTPClient).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bookmeta: google books returned status %d", resp.StatusCode)
+	}
+
+	var body googleBooksResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&body); err != nil {
+		return nil, err
+	}
+	if body.TotalItems == 0 || len(body.Items) == 0 || body.Items[0].VolumeInfo.Title == "" {
+		return nil, ErrNotFound
+	}
+	info := body.Items[0].VolumeInfo
+
+	title := strings.TrimSpace(info.Title)
+	if subtitle := strings.TrimSpace(info.Subtitle); subtitle != "" {
+		title += " " + subtitle
+	}
+
+	return &Metadata{
+		ISBN:  isbn13,
+		Title: title,
+		// サムネイルは http の URL で返るため https に揃える
+		ImageURL:      strings.Replace(info.ImageLinks.Thumbnail, "http://", "https://", 1),
+		Authors:       NormalizeAuthorNames(info.Authors),
+		Publisher:     strings.TrimSpace(info.Publisher),
+		PublishedDate: normalizeDate(info.PublishedDate),
+		PageCount:     info.PageCount,
+		Language:      normalizeLanguage(info.Language),
+		Description:   strings.TrimSpace(info.Description),
+	}, nil
+}
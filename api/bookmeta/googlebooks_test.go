@@ -0,0 +1,93 @@
+package bookmeta
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const googleBooksVolumeJSON = `{
+  "totalItems": 1,
+  "items": [{
+    "volumeInfo": {
+      "title": "The Go Programming Language",
+      "subtitle": "Second Edition",
+      "authors": ["Alan A. A. Donovan", " Brian W.  Kernighan "],
+      "publisher": "Addison-Wesley",
+      "publishedDate": "2015-10-26",
+      "description": "The authoritative resource.",
+      "pageCount": 380,
+      "language": "en",
+      "imageLinks": {"thumbnail": "http://books.google.com/books/content?id=abc&img=1"}
+    }
+  }]
+}`
+
+// newGoogleBooksServer は /volumes?q=isbn: に body を返す Google Books API の代わりのサーバー
+func newGoogleBooksServer(t *testing.T, apiKey string, status int, body string) *GoogleBooksProvider {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/volumes" || query.Get("q") != "isbn:9780134190440" || query.Get("key") != apiKey {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return &GoogleBooksProvider{BaseURL: server.URL, APIKey: apiKey, HTTPClient: server.Client()}
+}
+
+func TestGoogleBooksProvider(t *testing.T) {
+	provider := newGoogleBooksServer(t, "test-key", http.StatusOK, googleBooksVolumeJSON)
+
+	got, err := provider.Lookup(context.Background(), "9780134190440")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	want := &Metadata{
+		ISBN:          "9780134190440",
+		Title:         "The Go Programming Language Second Edition",
+		ImageURL:      "https://books.google.com/books/content?id=abc&img=1",
+		Authors:       []string{"Alan A. A. Donovan", "Brian W. Kernighan"},
+		Publisher:     "Addison-Wesley",
+		PublishedDate: "2015-10-26",
+		PageCount:     380,
+		Language:      "en",
+		Description:   "The authoritative resource.",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestGoogleBooksProviderErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		notFound bool
+	}{
+		{"not found", http.StatusOK, `{"totalItems": 0}`, true},
+		{"no title", http.StatusOK, `{"totalItems": 1, "items": [{"volumeInfo": {}}]}`, true},
+		{"rate limited", http.StatusTooManyRequests, `{}`, false},
+		{"too large", http.StatusOK, `{"totalItems": 1, "items": [{"volumeInfo": {"description": "` + strings.Repeat("a", maxResponseSize) + `"}}]}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newGoogleBooksServer(t, "", tt.status, tt.body)
+			_, err := provider.Lookup(context.Background(), "9780134190440")
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if errors.Is(err, ErrNotFound) != tt.notFound {
+				t.Errorf("got %v, want not found = %v", err, tt.notFound)
+			}
+		})
+	}
+}
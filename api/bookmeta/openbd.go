@@ -0,0 +1,160 @@
+package bookmeta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const defaultOpenBDURL = "https://api.openbd.jp/v1"
+
+// onixRoleAuthor は ONIX の ContributorRole で著者（By (author)）を表すコード
+const onixRoleAuthor = "A01"
+
+// summaryAuthorPattern は summary.author の「著者名／役割」1件分。
+// 複数の場合は「村上 春樹／著 柴田 元幸／訳」のように空白で続くが、名前自体にも空白を含むことがある
+var summaryAuthorPattern = regexp.MustCompile(`\s*(.+?)／(\S+)`)
+
+// OpenBDProvider は openBD から書誌情報を取得する。国内の書籍に強い。
+type OpenBDProvider struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+type openBDRecord struct {
+	Summary struct {
+		Title     string `json:"title"`
+		Publisher string `json:"publisher"`
+		Pubdate   string `json:"pubdate"`
+		Cover     string `json:"cover"`
+		Author    string `json:"author"`
+	} `json:"summary"`
+	Onix struct {
+		DescriptiveDetail struct {
+			Contributor []struct {
+				ContributorRole []string `json:"ContributorRole"`
+				PersonName      struct {
+					Content string `json:"content"`
+				} `json:"PersonName"`
+			} `json:"Contributor"`
+			Language []struct {
+				LanguageCode string `json:"LanguageCode"`
+			} `json:"Language"`
+			Extent []struct {
+				ExtentType  string `json:"ExtentType"`
+				ExtentValue string `json:"ExtentValue"`
+			} `json:"Extent"`
+		} `json:"DescriptiveDetail"`
+		CollateralDetail struct {
+			TextContent []struct {
+				TextType string `json:"TextType"`
+				Text     string `json:"Text"`
+			} `json:"TextContent"`
+		} `json:"CollateralDetail"`
+	} `json:"onix"`
+}
+
+func (p *OpenBDProvider) Lookup(ctx context.Context, isbn13 string) (*Metadata, error) {
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = defaultOpenBDURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/get?isbn="+url.QueryEscape(isbn13), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient(p.HTTPClient).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bookmeta: openbd returned status %d", resp.StatusCode)
+	}
+
+	// 見つからない ISBN は [null] が返る
+	var records []*openBDRecord
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&records); err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || records[0] == nil || records[0].Summary.Title == "" {
+		return nil, ErrNotFound
+	}
+	record := records[0]
+
+	metadata := &Metadata{
+		ISBN:          isbn13,
+		Title:         strings.TrimSpace(record.Summary.Title),
+		ImageURL:      record.Summary.Cover,
+		Publisher:     strings.TrimSpace(record.Summary.Publisher),
+		PublishedDate: normalizeDate(record.Summary.Pubdate),
+	}
+
+	detail := record.Onix.DescriptiveDetail
+	authors := []string{}
+	for _, contributor := range detail.Contributor {
+		// 訳者や編者などは除き、著者だけを取り出す
+		for _, role := range contributor.ContributorRole {
+			if role == onixRoleAuthor {
+				authors = append(authors, contributor.PersonName.Content)
+				break
+			}
+		}
+	}
+	if len(authors) == 0 {
+		authors = summaryAuthors(record.Summary.Author)
+	}
+	metadata.Authors = NormalizeAuthorNames(authors)
+
+	if len(detail.Language) > 0 {
+		metadata.Language = normalizeLanguage(detail.Language[0].LanguageCode)
+	}
+	for _, extent := range detail.Extent {
+		// ExtentType 11 は本文のページ数
+		if extent.ExtentType == "11" {
+			if pages, err := strconv.Atoi(extent.ExtentValue); err == nil && pages > 0 {
+				metadata.PageCount = pages
+			}
+		}
+	}
+	for _, text := range record.Onix.CollateralDetail.TextContent {
+		// TextType 03 は内容紹介、02 は短い紹介文
+		if text.TextType == "03" || (text.TextType == "02" && metadata.Description == "") {
+			metadata.Description = strings.TrimSpace(text.Text)
+		}
+	}
+
+	return metadata, nil
+}
+
+// summaryAuthors は summary.author（「著者名／著 訳者名／訳」の形式）から役割が著者の名前を取り出す。
+// 役割の表記がない場合は全体を1人の著者名として扱う。
+func summaryAuthors(summary string) []string {
+	matches := summaryAuthorPattern.FindAllStringSubmatch(summary, -1)
+	if len(matches) == 0 {
+		return []string{summary}
+	}
+
+	authors := []string{}
+	for _, match := range matches {
+		// 著・編著・共著などは著者として扱い、訳・監修・イラストなどは除く
+		if strings.Contains(match[2], "著") {
+			authors = append(authors, match[1])
+		}
+	}
+	return authors
+}
+
+func httpClient(client *http.Client) *http.Client {
+	if client == nil {
+		return http.DefaultClient
+	}
+	return client
+}
@@ -0,0 +1,135 @@
+package bookmeta
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const openBDRecordJSON = `[{
+  "onix": {
+    "DescriptiveDetail": {
+      "Contributor": [
+        {"ContributorRole": ["A01"], "PersonName": {"content": "芥川 龍之介"}},
+        {"ContributorRole": ["B06"], "PersonName": {"content": "訳者 太郎"}}
+      ],
+      "Language": [{"LanguageCode": "jpn", "LanguageRole": "01"}],
+      "Extent": [{"ExtentType": "11", "ExtentValue": "192", "ExtentUnit": "03"}]
+    },
+    "CollateralDetail": {
+      "TextContent": [
+        {"TextType": "02", "Text": "短い紹介文"},
+        {"TextType": "03", "Text": "王朝物の短編集"}
+      ]
+    }
+  },
+  "summary": {
+    "isbn": "9784101001616",
+    "title": "羅生門・鼻",
+    "publisher": "新潮社",
+    "pubdate": "20050101",
+    "cover": "https://cover.openbd.jp/9784101001616.jpg",
+    "author": "芥川 龍之介／著 訳者 太郎／訳"
+  }
+}]`
+
+// newOpenBDServer は /get?isbn= に body を返す openBD の代わりのサーバー
+func newOpenBDServer(t *testing.T, status int, body string) *OpenBDProvider {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/get" || r.URL.Query().Get("isbn") != "9784101001616" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return &OpenBDProvider{BaseURL: server.URL, HTTPClient: server.Client()}
+}
+
+func TestOpenBDProvider(t *testing.T) {
+	provider := newOpenBDServer(t, http.StatusOK, openBDRecordJSON)
+
+	got, err := provider.Lookup(context.Background(), "9784101001616")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	want := &Metadata{
+		ISBN:          "9784101001616",
+		Title:         "羅生門・鼻",
+		ImageURL:      "https://cover.openbd.jp/9784101001616.jpg",
+		Authors:       []string{"芥川 龍之介"},
+		Publisher:     "新潮社",
+		PublishedDate: "2005-01-01",
+		PageCount:     192,
+		Language:      "ja",
+		Description:   "王朝物の短編集",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestOpenBDProviderSummaryAuthors(t *testing.T) {
+	body := `[{"summary": {"title": "翻訳書", "author": "村上 春樹／著 柴田 元幸／訳 カーヴァー,レイモンド／編著"}}]`
+	provider := newOpenBDServer(t, http.StatusOK, body)
+
+	got, err := provider.Lookup(context.Background(), "9784101001616")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	want := []string{"村上 春樹", "カーヴァー,レイモンド"}
+	if !reflect.DeepEqual(got.Authors, want) {
+		t.Errorf("got %q, want %q", got.Authors, want)
+	}
+}
+
+func TestSummaryAuthors(t *testing.T) {
+	tests := []struct {
+		summary string
+		want    []string
+	}{
+		{"夏目漱石", []string{"夏目漱石"}},
+		{"夏目 漱石／著", []string{"夏目 漱石"}},
+		{"村上 春樹／著 柴田 元幸／訳", []string{"村上 春樹"}},
+		{"山田 太郎／監修", []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := summaryAuthors(tt.summary); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("summaryAuthors(%q): got %q, want %q", tt.summary, got, tt.want)
+		}
+	}
+}
+
+func TestOpenBDProviderErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		notFound bool
+	}{
+		{"not found", http.StatusOK, `[null]`, true},
+		{"server error", http.StatusInternalServerError, `{}`, false},
+		{"invalid json", http.StatusOK, `<html>`, false},
+		// 上限を超えるレスポンスは途中までしか読まず、JSON として不完全になる
+		{"too large", http.StatusOK, `[{"summary": {"title": "` + strings.Repeat("a", maxResponseSize) + `"}}]`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newOpenBDServer(t, tt.status, tt.body)
+			_, err := provider.Lookup(context.Background(), "9784101001616")
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if errors.Is(err, ErrNotFound) != tt.notFound {
+				t.Errorf("got %v, want not found = %v", err, tt.notFound)
+			}
+		})
+	}
+}
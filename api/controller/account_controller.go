@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/repository"
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+	"time"
+)
+
+type DeleteAccountRequest struct {
+	Password         string `json:"password"`
+	Code             string `json:"code"`
+	Books            string `json:"books" binding:"omitempty,oneof=transfer delete"`
+	TransferToUserID uint   `json:"transferToUserId"`
+}
+
+type DeleteUserRequest struct {
+	Books            string `json:"books" binding:"omitempty,oneof=transfer delete"`
+	TransferToUserID uint   `json:"transferToUserId"`
+}
+
+var accountRepo = repository.NewAccountRepository()
+
+// recentLoginWindow はパスワードの代わりに本人確認として扱うログインからの経過時間
+const recentLoginWindow = time.Minute * 5
+
+// DeleteMe は本人の退会手続き。
+// 二要素認証が有効な場合は認証コードで、それ以外はパスワードか直前のログインで本人確認する。
+// シングルサインオンだけで利用していてパスワードを持たない利用者も、ログインし直せば退会できる。
+func DeleteMe(c *gin.Context) {
+	var request DeleteAccountRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	user, err := authRepo.FindUserByID(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "認証が必要です"})
+		return
+	}
+
+	if !reauthenticate(c, user, request.Password, request.Code) {
+		return
+	}
+
+	if !deleteAccount(c, user.ID, request.Books, request.TransferToUserID) {
+		return
+	}
+
+	recordAudit(c, repository.AuditAccountDeleted, user.ID, repository.AuditTargetUser, user.ID, gin.H{"books": request.Books, "transferToUserId": request.TransferToUserID})
+
+	c.JSON(http.StatusOK, gin.H{"message": "退会しました"})
+}
+
+// reauthenticate は退会前の本人確認を行い、失敗した場合はエラーレスポンスを書いて false を返す。
+func reauthenticate(c *gin.Context, user *schema.User, password, code string) bool {
+	enabled, err := twoFactorRepo.IsEnabled(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "退会処理に失敗しました"})
+		return false
+	}
+	if enabled {
+		return verifyTwoFactorCode(c, user, code)
+	}
+
+	return confirmPasswordOrRecentLogin(c, user, password, "退会")
+}
+
+// confirmPasswordOrRecentLogin はパスワード、パスワードが指定されていない場合は recentLoginWindow 以内の
+// ログインで本人確認を行い、失敗した場合はエラーレスポンスを書いて false を返す。
+// action はログインし直すよう求めるメッセージに入れる操作の名前。
+func confirmPasswordOrRecentLogin(c *gin.Context, user *schema.User, password, action string) bool {
+	if password != "" {
+		if err := authRepo.ValidatePassword(user, password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "パスワードが正しくありません"})
+			return false
+		}
+		return true
+	}
+
+	recent, err := sessionRepo.LoggedInSince(user.ID, c.GetUint("session_id"), time.Now().Add(-recentLoginWindow))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "本人確認に失敗しました"})
+		return false
+	}
+	if !recent {
+		c.JSON(http.StatusForbidden, gin.H{"error": "本人確認のため、パスワードを入力するか、ログインし直してから" + action + "してください"})
+		return false
+	}
+	return true
+}
+
+// DeleteUser は管理者が利用者の依頼を受けてアカウントを削除する。
+func DeleteUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不正なユーザIDです"})
+		return
+	}
+
+	// 本を所有していないユーザーはボディなしで削除できる
+	var request DeleteUserRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	if uint(id) == c.GetUint("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "自分自身のアカウントは /api/me から削除してください"})
+		return
+	}
+
+	if !deleteAccount(c, uint(id), request.Books, request.TransferToUserID) {
+		return
+	}
+
+	recordAudit(c, repository.AuditUserDeleted, c.GetUint("user_id"), repository.AuditTargetUser, uint(id), gin.H{"books": request.Books, "transferToUserId": request.TransferToUserID})
+
+	c.JSON(http.StatusOK, gin.H{"message": "ユーザを削除しました"})
+}
+
+// deleteAccount は退会処理を行い、失敗した場合はエラーレスポンスを書いて false を返す。
+func deleteAccount(c *gin.Context, userID uint, books string, transferTo uint) bool {
+	err := accountRepo.DeleteAccount(userID, repository.BookDisposition(books), transferTo)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "ユーザが見つかりません"})
+	case errors.Is(err, repository.ErrAccountHasActiveLoans):
+		c.JSON(http.StatusConflict, gin.H{"error": "返却していない本があるため退会できません"})
+	case errors.Is(err, repository.ErrOwnedBooksOnLoan):
+		c.JSON(http.StatusConflict, gin.H{"error": "貸し出し中の本があるため削除できません。返却後に再度お試しいただくか、本を他のユーザに譲渡してください"})
+	case errors.Is(err, repository.ErrBookDispositionRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "所有している本の扱い（transfer または delete）を指定してください"})
+	case errors.Is(err, repository.ErrBookTransferTargetInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "本の譲渡先のユーザが見つかりません"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "退会処理に失敗しました"})
+	}
+	return false
+}
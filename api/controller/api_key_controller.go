@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/repository"
+	"github.com/sayasurvey/golang/model/schema"
+)
+
+type CreateAPIKeyRequest struct {
+	Name      string   `json:"name" binding:"required,max=255"`
+	Scopes    []string `json:"scopes" binding:"required,min=1"`
+	ExpiresAt string   `json:"expiresAt"`
+}
+
+type APIKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+var apiKeyRepo = repository.NewAPIKeyRepository()
+
+func toAPIKeyResponse(apiKey schema.APIKey) APIKeyResponse {
+	scopes := []string{}
+	for _, scope := range repository.ParseAPIKeyScopes(apiKey.Scopes) {
+		scopes = append(scopes, string(scope))
+	}
+	return APIKeyResponse{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     scopes,
+		CreatedAt:  apiKey.CreatedAt,
+		ExpiresAt:  apiKey.ExpiresAt,
+		LastUsedAt: apiKey.LastUsedAt,
+	}
+}
+
+func GetAPIKeys(c *gin.Context) {
+	apiKeys, err := apiKeyRepo.GetAPIKeysByUserID(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "API キーの取得に失敗しました"})
+		return
+	}
+
+	response := []APIKeyResponse{}
+	for _, apiKey := range apiKeys {
+		response = append(response, toAPIKeyResponse(apiKey))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"apiKeys": response,
+	})
+}
+
+func CreateAPIKey(c *gin.Context) {
+	var request CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	var scopes []schema.APIKeyScope
+	for _, name := range request.Scopes {
+		parsed := repository.ParseAPIKeyScopes(name)
+		if len(parsed) != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不正なスコープです: " + name})
+			return
+		}
+		scopes = append(scopes, parsed[0])
+	}
+
+	var expiresAt *time.Time
+	if request.ExpiresAt != "" {
+		parsed, err := time.Parse("2006-01-02", request.ExpiresAt)
+		if err != nil || !parsed.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "有効期限は未来の日付を YYYY-MM-DD 形式で入力してください"})
+			return
+		}
+		expiresAt = &parsed
+	}
+
+	apiKey, key, err := apiKeyRepo.CreateAPIKey(c.GetUint("user_id"), request.Name, scopes, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "API キーの作成に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditAPIKeyCreated, c.GetUint("user_id"), repository.AuditTargetAPIKey, apiKey.ID, gin.H{"name": apiKey.Name, "scopes": request.Scopes})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API キーを作成しました。キーはこの画面でしか表示されません",
+		"key":     key,
+		"apiKey":  toAPIKeyResponse(*apiKey),
+	})
+}
+
+func RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不正な API キー ID です"})
+		return
+	}
+
+	if err := apiKeyRepo.RevokeAPIKey(c.GetUint("user_id"), uint(id)); err != nil {
+		if errors.Is(err, repository.ErrAPIKeyInvalid) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API キーが見つかりません"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "API キーの削除に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditAPIKeyRevoked, c.GetUint("user_id"), repository.AuditTargetAPIKey, uint(id), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "API キーを削除しました"})
+}
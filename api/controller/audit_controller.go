@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/pagination"
+	"github.com/sayasurvey/golang/api/repository"
+	"github.com/sayasurvey/golang/model/schema"
+)
+
+type AuditEventResponse struct {
+	ID         uint            `json:"id"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	ActorID    *uint           `json:"actorId"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"targetType"`
+	TargetID   *uint           `json:"targetId"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"userAgent"`
+	Metadata   json.RawMessage `json:"metadata"`
+}
+
+type AuditEventsResponse struct {
+	Events []AuditEventResponse `json:"events"`
+	pagination.Page
+}
+
+var auditRepo = repository.NewAuditRepository()
+
+// recordAudit は監査ログを1件書き込む。操作者が特定できない場合は actorID に 0 を渡す。
+// 監査ログは退会後も消せないため、metadata にメールアドレスなどの個人データは入れず、利用者は ID で表す。
+// 書き込みに失敗しても元の操作は失敗させない。
+func recordAudit(c *gin.Context, action string, actorID uint, targetType string, targetID uint, metadata gin.H) {
+	event := schema.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	if actorID != 0 {
+		event.ActorID = &actorID
+	}
+	if targetID != 0 {
+		event.TargetID = &targetID
+	}
+
+	if err := auditRepo.Record(event, metadata); err != nil {
+		fmt.Println("監査ログの書き込みに失敗しました:", action, err)
+	}
+}
+
+// GetAuditEvents は監査ログを新しい順に返す（管理者用）。
+func GetAuditEvents(c *gin.Context) {
+	filter, ok := bindAuditFilter(c)
+	if !ok {
+		return
+	}
+
+	params, err := pagination.Parse(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cursor が正しくありません"})
+		return
+	}
+
+	events, page, err := auditRepo.SearchEvents(filter, params)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cursor が正しくありません"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "監査ログの取得に失敗しました"})
+		return
+	}
+
+	response := []AuditEventResponse{}
+	for _, event := range events {
+		response = append(response, AuditEventResponse{
+			ID:         event.ID,
+			CreatedAt:  event.CreatedAt,
+			ActorID:    event.ActorID,
+			Action:     event.Action,
+			TargetType: event.TargetType,
+			TargetID:   event.TargetID,
+			IP:         event.IP,
+			UserAgent:  event.UserAgent,
+			Metadata:   json.RawMessage(event.Metadata),
+		})
+	}
+
+	c.JSON(http.StatusOK, AuditEventsResponse{
+		Events: response,
+		Page:   pagination.NewPage(c, params, page),
+	})
+}
+
+// ExportAuditEvents は検索条件に合う監査ログを全件 CSV で返す（管理者用）。
+func ExportAuditEvents(c *gin.Context) {
+	filter, ok := bindAuditFilter(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-events-%s.csv"`, time.Now().Format("20060102-150405")))
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"id", "created_at", "actor_id", "action", "target_type", "target_id", "ip", "user_agent", "metadata"})
+
+	err := auditRepo.EachEvent(filter, func(event schema.AuditEvent) error {
+		return writer.Write([]string{
+			strconv.FormatUint(uint64(event.ID), 10),
+			event.CreatedAt.Format(time.RFC3339),
+			formatOptionalID(event.ActorID),
+			event.Action,
+			event.TargetType,
+			formatOptionalID(event.TargetID),
+			event.IP,
+			csvSafe(event.UserAgent),
+			csvSafe(event.Metadata),
+		})
+	})
+	writer.Flush()
+	if err != nil {
+		// ヘッダー送信後なのでステータスは変えられない。途中で打ち切られたことだけ記録する
+		fmt.Println("監査ログの CSV 出力に失敗しました:", err)
+	}
+}
+
+// bindAuditFilter はクエリパラメータから検索条件を作る。不正な値の場合は 400 を返して false を返す。
+// from / to は YYYY-MM-DD または RFC3339。日付だけの to はその日の終わりまでを含む。
+func bindAuditFilter(c *gin.Context) (repository.AuditFilter, bool) {
+	filter := repository.AuditFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("targetType"),
+		IP:         c.Query("ip"),
+	}
+
+	for name, target := range map[string]*uint{"actorId": &filter.ActorID, "targetId": &filter.TargetID} {
+		if value := c.Query(name); value != "" {
+			parsed, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "不正な " + name + " です"})
+				return filter, false
+			}
+			*target = uint(parsed)
+		}
+	}
+
+	if value := c.Query("from"); value != "" {
+		from, _, err := parseAuditTime(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from は YYYY-MM-DD または RFC3339 形式で指定してください"})
+			return filter, false
+		}
+		filter.From = from
+	}
+	if value := c.Query("to"); value != "" {
+		to, dateOnly, err := parseAuditTime(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to は YYYY-MM-DD または RFC3339 形式で指定してください"})
+			return filter, false
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = to
+	}
+
+	return filter, true
+}
+
+func parseAuditTime(value string) (time.Time, bool, error) {
+	if parsed, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return parsed, true, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	return parsed, false, err
+}
+
+func formatOptionalID(id *uint) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*id), 10)
+}
+
+// csvSafe は表計算ソフトで開いたときに数式として解釈されないよう、先頭の記号をエスケープする。
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
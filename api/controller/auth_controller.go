@@ -1,15 +1,25 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/authcookie"
 	"github.com/sayasurvey/golang/api/repository"
+	"github.com/sayasurvey/golang/model/schema"
 )
 
 type RegisterRequest struct {
-	Name     string `json:"name" binding:"required"`
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Name       string `json:"name" binding:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required"`
+	InviteCode string `json:"inviteCode"`
 }
 
 type LoginRequest struct {
@@ -17,9 +27,21 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// RefreshTokenRequest の refreshToken はクッキー認証の場合は省略できる。
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// AuthResponse のトークンは、クッキー認証の場合はボディに含めず CSRFToken を返す。
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  struct {
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	CSRFToken    string `json:"csrfToken,omitempty"`
+	User         struct {
 		ID    uint   `json:"id"`
 		Name  string `json:"name"`
 		Email string `json:"email"`
@@ -27,14 +49,22 @@ type AuthResponse struct {
 	} `json:"user"`
 }
 
-type UserResponse struct {
-	ID    uint   `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	Role  string `json:"role"`
-}
-
 var authRepo = repository.NewAuthRepository()
+var refreshTokenRepo = repository.NewRefreshTokenRepository()
+var sessionRepo = repository.NewSessionRepository()
+
+var loginThrottle *repository.LoginThrottle
+var loginThrottleOnce sync.Once
+
+// getLoginThrottle は初回利用時に環境変数から設定を読んで LoginThrottle を生成する。
+func getLoginThrottle() *repository.LoginThrottle {
+	loginThrottleOnce.Do(func() {
+		if loginThrottle == nil {
+			loginThrottle = repository.NewLoginThrottle(repository.NewDBLoginAttemptStore())
+		}
+	})
+	return loginThrottle
+}
 
 func Register(c *gin.Context) {
 	var request RegisterRequest
@@ -43,11 +73,51 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	if err := authRepo.CreateUser(request.Name, request.Email, request.Password); err != nil {
+	if !checkPasswordPolicy(c, request.Password) {
+		return
+	}
+
+	if err := inviteRepo.CheckEmailDomain(request.Email); err != nil {
+		if errors.Is(err, repository.ErrEmailDomainRejected) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "このメールアドレスのドメインでは登録できません"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "ユーザの登録に失敗しました"})
 		return
 	}
 
+	inviteRequired, err := inviteRepo.InviteRequired()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ユーザの登録に失敗しました"})
+		return
+	}
+
+	var user *schema.User
+	if inviteRequired {
+		if request.InviteCode == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "登録には招待コードが必要です"})
+			return
+		}
+		user, err = inviteRepo.RegisterWithInvite(request.InviteCode, request.Name, request.Email, request.Password)
+	} else {
+		user, err = authRepo.CreateUser(request.Name, request.Email, request.Password)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrInviteInvalid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "招待コードが無効か有効期限が切れています"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ユーザの登録に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditUserRegistered, user.ID, repository.AuditTargetUser, user.ID, gin.H{"invited": inviteRequired})
+
+	// ユーザーは作成済みなので、送信に失敗しても再送信で確認できるよう 201 を返す
+	if err := sendVerificationEmail(user, user.Email); err != nil {
+		fmt.Println("確認メールの送信に失敗しました:", err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "ユーザ登録が完了しました",
 	})
@@ -60,25 +130,80 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	user, err := authRepo.FindUserByEmail(request.Email)
+	throttle := getLoginThrottle()
+	accountKey := repository.AccountAttemptKey(request.Email)
+	ipKey := repository.IPAttemptKey(c.ClientIP())
+
+	// ロック中も登録有無が分からないよう、通常の失敗と同じメッセージを返す
+	retryAfter, err := throttle.RetryAfter(accountKey, ipKey)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ログインに失敗しました"})
+		return
+	}
+	if retryAfter > 0 {
+		var actorID uint
+		if user, err := authRepo.FindUserByEmail(request.Email); err == nil {
+			actorID = user.ID
+		}
+		recordAudit(c, repository.AuditLoginLocked, actorID, "", 0, nil)
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "メールアドレスまたはパスワードが正しくありません"})
 		return
 	}
 
-	if err := authRepo.ValidatePassword(user, request.Password); err != nil {
+	user, err := authRepo.FindUserByEmail(request.Email)
+	if err == nil {
+		err = authRepo.ValidatePassword(user, request.Password)
+	} else {
+		authRepo.ValidateDummyPassword(request.Password)
+	}
+	if err != nil {
+		if err := throttle.RecordFailure(accountKey, ipKey); err != nil {
+			fmt.Println("ログイン失敗の記録に失敗しました:", err)
+		}
+		var actorID uint
+		if user != nil {
+			actorID = user.ID
+		}
+		recordAudit(c, repository.AuditLoginFailed, actorID, "", 0, gin.H{"reason": "password"})
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "メールアドレスまたはパスワードが正しくありません"})
 		return
 	}
 
-	tokenString, err := authRepo.GenerateToken(user)
+	if err := throttle.Reset(accountKey); err != nil {
+		fmt.Println("ログイン失敗記録のリセットに失敗しました:", err)
+	}
+
+	if user.VerifiedAt == nil && emailVerificationGate() == verificationGateLogin {
+		recordAudit(c, repository.AuditLoginFailed, user.ID, "", 0, gin.H{"reason": "unverified"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "メールアドレスの確認が完了していません"})
+		return
+	}
+
+	completeLogin(c, user)
+}
+
+// respondWithTokens はセッションを作成し、アクセストークンとリフレッシュトークンを発行してログイン結果を返す。
+func respondWithTokens(c *gin.Context, user *schema.User) {
+	session, err := sessionRepo.CreateSession(user.ID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "セッションの作成に失敗しました"})
+		return
+	}
+
+	tokenString, err := authRepo.GenerateToken(user, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "トークンの生成に失敗しました"})
+		return
+	}
+
+	refreshToken, err := refreshTokenRepo.IssueRefreshToken(user.ID, session.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "トークンの生成に失敗しました"})
 		return
 	}
 
 	response := AuthResponse{
-		Token: tokenString,
 		User: struct {
 			ID    uint   `json:"id"`
 			Name  string `json:"name"`
@@ -92,33 +217,177 @@ func Login(c *gin.Context) {
 		},
 	}
 
+	if authcookie.Current().Enabled {
+		csrfToken, err := authcookie.SetTokens(c, tokenString, repository.AccessTokenTTL, refreshToken, repository.RefreshTokenTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "トークンの生成に失敗しました"})
+			return
+		}
+		response.CSRFToken = csrfToken
+	} else {
+		response.Token = tokenString
+		response.RefreshToken = refreshToken
+	}
+
+	recordAudit(c, repository.AuditLoginSucceeded, user.ID, repository.AuditTargetSession, session.ID, nil)
+
 	c.JSON(http.StatusOK, response)
 }
 
 func Logout(c *gin.Context) {
+	tokenID := c.GetString("token_id")
+	expiresAt, exists := c.Get("token_expires_at")
+	if tokenID == "" || !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "認証が必要です"})
+		return
+	}
+
+	// リフレッシュトークンは任意。渡された場合はそのファミリーも失効させる
+	// （sid を持たない旧形式のトークンでログインしている場合のため）
+	var request LogoutRequest
+	_ = c.ShouldBindJSON(&request)
+	if request.RefreshToken == "" {
+		request.RefreshToken = authcookie.Token(c, authcookie.RefreshTokenCookie)
+	}
+
+	if err := authRepo.InvalidateToken(tokenID, expiresAt.(time.Time)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ログアウトに失敗しました"})
+		return
+	}
+
+	if sessionID := c.GetUint("session_id"); sessionID != 0 {
+		if err := sessionRepo.RevokeSession(c.GetUint("user_id"), sessionID); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ログアウトに失敗しました"})
+			return
+		}
+	}
+
+	if request.RefreshToken != "" {
+		if err := refreshTokenRepo.RevokeRefreshToken(request.RefreshToken); err != nil && !errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ログアウトに失敗しました"})
+			return
+		}
+	}
+
+	if authcookie.Current().Enabled {
+		authcookie.Clear(c)
+	}
+
+	recordAudit(c, repository.AuditLogout, c.GetUint("user_id"), repository.AuditTargetSession, c.GetUint("session_id"), nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "ログアウトしました",
 	})
 }
 
-func GetUsers(c *gin.Context) {
-	users, err := authRepo.GetAllUsers()
+func RefreshToken(c *gin.Context) {
+	// クッキー認証ではボディなしで呼ばれる。CSRF で更新されても新しいトークンは攻撃者からは読めないため、
+	// ページ再読み込み後に CSRF トークンを取り直せるよう、ここでは CSRF トークンを確認しない
+	var request RefreshTokenRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+	if request.RefreshToken == "" {
+		request.RefreshToken = authcookie.Token(c, authcookie.RefreshTokenCookie)
+	}
+	if request.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	user, sessionID, refreshToken, err := refreshTokenRepo.RotateRefreshToken(request.RefreshToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "ユーザー一覧の取得に失敗しました"})
+		if errors.Is(err, repository.ErrRefreshTokenReused) {
+			recordAudit(c, repository.AuditRefreshTokenReused, 0, "", 0, nil)
+		}
+		switch {
+		case errors.Is(err, repository.ErrRefreshTokenNotFound),
+			errors.Is(err, repository.ErrRefreshTokenExpired),
+			errors.Is(err, repository.ErrRefreshTokenReused):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "無効なリフレッシュトークンです"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "トークンの更新に失敗しました"})
+		}
 		return
 	}
 
-	var response []UserResponse
-	for _, user := range users {
-		response = append(response, UserResponse{
-			ID:    user.ID,
-			Name:  user.Name,
-			Email: user.Email,
-			Role:  string(user.Role),
-		})
+	if sessionID != 0 {
+		active, err := sessionRepo.Touch(sessionID, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "トークンの更新に失敗しました"})
+			return
+		}
+		// 失効したセッションのリフレッシュトークンでは新しいトークンを発行しない
+		if !active {
+			if err := refreshTokenRepo.RevokeRefreshToken(refreshToken); err != nil && !errors.Is(err, repository.ErrRefreshTokenNotFound) {
+				fmt.Println("リフレッシュトークンの失効に失敗しました:", err)
+			}
+			if authcookie.Current().Enabled {
+				authcookie.Clear(c)
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "セッションが無効です。再度ログインしてください"})
+			return
+		}
+	}
+
+	tokenString, err := authRepo.GenerateToken(user, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "トークンの生成に失敗しました"})
+		return
+	}
+
+	if authcookie.Current().Enabled {
+		csrfToken, err := authcookie.SetTokens(c, tokenString, repository.AccessTokenTTL, refreshToken, repository.RefreshTokenTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "トークンの生成に失敗しました"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"csrfToken": csrfToken})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"users": response,
+		"token":        tokenString,
+		"refreshToken": refreshToken,
 	})
 }
+
+type UnlockUserRequest struct {
+	IP string `json:"ip"`
+}
+
+// UnlockUser はログイン失敗によるアカウントのロックを解除する（管理者用）。
+// ip を指定した場合はその IP アドレスのロックも解除する。
+func UnlockUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不正なユーザーIDです"})
+		return
+	}
+
+	var request UnlockUserRequest
+	_ = c.ShouldBindJSON(&request)
+
+	user, err := authRepo.FindUserByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ユーザーが見つかりません"})
+		return
+	}
+
+	throttle := getLoginThrottle()
+	if err := throttle.Reset(repository.AccountAttemptKey(user.Email)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ロックの解除に失敗しました"})
+		return
+	}
+	if request.IP != "" {
+		if err := throttle.Reset(repository.IPAttemptKey(request.IP)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ロックの解除に失敗しました"})
+			return
+		}
+	}
+
+	recordAudit(c, repository.AuditUserUnlocked, c.GetUint("user_id"), repository.AuditTargetUser, user.ID, gin.H{"ip": request.IP})
+
+	c.JSON(http.StatusOK, gin.H{"message": "ロックを解除しました"})
+}
@@ -6,8 +6,13 @@ import (
 	"net/http"
 	"github.com/sayasurvey/golang/model/schema"
 	"github.com/sayasurvey/golang/model/database"
-	"github.com/sayasurvey/golang/api/helper"
+	"github.com/sayasurvey/golang/api/pagination"
 	"strconv"
+	"strings"
+	"unicode/utf8"
+	"time"
+	"errors"
+	"gorm.io/gorm"
 )
 
 type BookResponse struct {
@@ -16,33 +21,34 @@ type BookResponse struct {
 	ImageUrl 	string 		`json:"imageUrl"`
 	Loanable 	bool 		`json:"loanable"`
 	IsWishList  bool        `json:"isWishList"`
+	Tags        []string    `json:"tags"`
 	User    struct {
 		ID   uint    	`json:"id"`
 		Name string 	`json:"name"`
 	} `json:"user"`
+	BookMetadataResponse
 }
 
 type BooksResponse struct {
 	Books      []BookResponse `json:"books"`
-	CurrentPage int           `json:"currentPage"`
-	LastPage    int           `json:"lastPage"`
-	PerPage     int           `json:"perPage"`
+	pagination.Page
 }
 
-func GetBooks(c *gin.Context) {
-	page := 1
-	perPage := 50
+const maxBookSearchQueryLength = 200
 
-	if pageStr := c.Query("page"); pageStr != "" {
-		if parsedPage, err := strconv.Atoi(pageStr); err == nil && parsedPage > 0 {
-			page = parsedPage
-		}
-	}
+// maxBookTagLength はタグ名の最大文字数（tags.name の varchar(64)）
+const maxBookTagLength = 64
 
-	if perPageStr := c.Query("perPage"); perPageStr != "" {
-		if parsedPerPage, err := strconv.Atoi(perPageStr); err == nil && parsedPerPage > 0 {
-			perPage = parsedPerPage
-		}
+// GetBooks は本の一覧を返す。q を指定すると書名・著者名・説明文を検索し、関連度順に返す。
+// 検索では全角・半角、ひらがな・カタカナ、英字の大文字・小文字を区別しない。
+// 絞り込みと並び替えの指定は bindBookSearch を参照。
+func GetBooks(c *gin.Context) {
+	params, err := pagination.Parse(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "cursor が正しくありません",
+		})
+		return
 	}
 
 	userID, exists := c.Get("user_id")
@@ -53,7 +59,21 @@ func GetBooks(c *gin.Context) {
 		return
 	}
 
-	books, err := repository.GetAllBooks()
+	search, message := bindBookSearch(c)
+	if message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": message,
+		})
+		return
+	}
+
+	books, page, err := repository.SearchBooks(search, params)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "cursor が正しくありません",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "本の一覧取得に失敗しました",
@@ -61,8 +81,11 @@ func GetBooks(c *gin.Context) {
 		return
 	}
 
-	wishListRepo := repository.NewBorrowingWishListRepository()
-	wishList, err := wishListRepo.GetWishListByUserID(userID.(uint))
+	bookIDs := make([]uint, 0, len(books))
+	for _, book := range books {
+		bookIDs = append(bookIDs, book.ID)
+	}
+	wishListedBookIDs, err := wishListRepo.FindWishListedBookIDs(userID.(uint), bookIDs)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "お気に入り情報の取得に失敗しました",
@@ -71,11 +94,11 @@ func GetBooks(c *gin.Context) {
 	}
 
 	wishListMap := make(map[uint]bool)
-	for _, item := range wishList {
-		wishListMap[item.BookID] = true
+	for _, bookID := range wishListedBookIDs {
+		wishListMap[bookID] = true
 	}
 
-	var responseBooks []BookResponse
+	responseBooks := []BookResponse{}
 	for _, book := range books {
 		responseUser := BookResponse{
 			ID:       book.ID,
@@ -83,6 +106,7 @@ func GetBooks(c *gin.Context) {
 			ImageUrl: book.ImageUrl,
 			Loanable: book.Loanable,
 			IsWishList: wishListMap[book.ID],
+			Tags:       bookTagNames(&book),
 			User: struct {
 				ID   uint   `json:"id"`
 				Name string `json:"name"`
@@ -90,24 +114,107 @@ func GetBooks(c *gin.Context) {
 				ID:   book.User.ID,
 				Name: book.User.Name,
 			},
+			BookMetadataResponse: newBookMetadataResponse(book),
 		}
 		responseBooks = append(responseBooks, responseUser)
 	}
 
-	paginatedBooks, currentPage, lastPage := helper.Pagination(responseBooks, page, perPage)
-
 	c.JSON(http.StatusOK, BooksResponse{
-		Books:      paginatedBooks,
-		CurrentPage: currentPage,
-		LastPage:    lastPage,
-		PerPage:     perPage,
+		Books: responseBooks,
+		Page:  pagination.NewPage(c, params, page),
 	})
 }
 
+// bindBookSearch はクエリパラメータから検索条件を作る。不正な値がある場合はエラーメッセージを返す。
+//
+//	q             検索語
+//	loanable      true / false
+//	ownerId       所有者のユーザー ID
+//	tag           タグ名（完全一致）
+//	createdAfter  登録日時の下限（YYYY-MM-DD または RFC 3339）
+//	sort          title / createdAt / popularity。先頭に - を付けると降順
+func bindBookSearch(c *gin.Context) (repository.BookSearch, string) {
+	search := repository.BookSearch{Query: c.Query("q")}
+	if utf8.RuneCountInString(search.Query) > maxBookSearchQueryLength {
+		return search, "検索語が長すぎます"
+	}
+
+	if value := c.Query("loanable"); value != "" {
+		loanable, err := strconv.ParseBool(value)
+		if err != nil {
+			return search, "loanable は true または false で指定してください"
+		}
+		search.Loanable = &loanable
+	}
+
+	if value := c.Query("ownerId"); value != "" {
+		ownerID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || ownerID == 0 {
+			return search, "ownerId が正しくありません"
+		}
+		search.OwnerID = uint(ownerID)
+	}
+
+	if value := c.Query("tag"); value != "" {
+		search.Tag = strings.Join(strings.Fields(value), " ")
+		if utf8.RuneCountInString(search.Tag) > maxBookTagLength {
+			return search, "タグが長すぎます"
+		}
+	}
+
+	if value := c.Query("createdAfter"); value != "" {
+		createdAfter, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			createdAfter, err = time.ParseInLocation("2006-01-02", value, time.Local)
+		}
+		if err != nil {
+			return search, "createdAfter は YYYY-MM-DD または RFC 3339 の形式で指定してください"
+		}
+		search.CreatedAfter = &createdAfter
+	}
+
+	if value := c.Query("sort"); value != "" {
+		search.SortDesc = strings.HasPrefix(value, "-")
+		search.Sort = repository.BookSortField(strings.TrimPrefix(value, "-"))
+		if !repository.IsValidBookSortField(search.Sort) {
+			return search, "不正な並び順です: " + value
+		}
+	}
+
+	return search, ""
+}
+
+// normalizeTagNames は連続する空白をまとめ、空のタグと重複を取り除く。
+func normalizeTagNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	result := []string{}
+	for _, name := range names {
+		name = strings.Join(strings.Fields(name), " ")
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	return result
+}
+
+// bookTagNames は BookTags を読み込み済みの book のタグ名を付けた順に返す。
+func bookTagNames(book *schema.Book) []string {
+	names := []string{}
+	for _, bookTag := range book.BookTags {
+		names = append(names, bookTag.Tag.Name)
+	}
+	return names
+}
+
+// CreateBookRequest は title と imageUrl を省略した場合、isbn から取得した書誌情報で補う。
 type CreateBookRequest struct {
-	Title    string `json:"title" binding:"required"`
-	ImageUrl string `json:"imageUrl" binding:"required"`
-	Loanable bool   `json:"loanable"`
+	Title    string   `json:"title" binding:"max=255"`
+	ImageUrl string   `json:"imageUrl" binding:"max=255"`
+	Loanable bool     `json:"loanable"`
+	Tags     []string `json:"tags" binding:"omitempty,max=20,dive,max=64"`
+	BookMetadataRequest
 }
 
 func CreateBook(c *gin.Context) {
@@ -119,8 +226,42 @@ func CreateBook(c *gin.Context) {
 		return
 	}
 
+	if request.Title == "" || request.ImageUrl == "" {
+		if blank(request.ISBN) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "title と imageUrl を省略する場合は isbn を指定してください",
+			})
+			return
+		}
+		metadata, ok := lookupBookMetadata(c, *request.ISBN)
+		if !ok {
+			return
+		}
+		request.fillFrom(metadata)
+		if request.Title == "" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": "書誌情報からタイトルを取得できませんでした",
+			})
+			return
+		}
+		if request.ImageUrl == "" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": "書誌情報から表紙画像を取得できませんでした。imageUrl を指定してください",
+			})
+			return
+		}
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "認証が必要です",
+		})
+		return
+	}
+
 	var user schema.User
-	if err := database.Db.First(&user, 1).Error; err != nil {
+	if err := database.Db.First(&user, userID.(uint)).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "ユーザー情報の取得に失敗しました",
 		})
@@ -132,11 +273,17 @@ func CreateBook(c *gin.Context) {
 		Title:    request.Title,
 		ImageUrl: request.ImageUrl,
 		Loanable: request.Loanable,
-		User:     user,
 	}
 
-	result := database.Db.Create(&book)
-	if result.Error != nil {
+	authors, message := request.apply(&book)
+	if message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": message,
+		})
+		return
+	}
+
+	if err := repository.SaveBook(&book, authors, normalizeTagNames(request.Tags)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "本の作成に失敗しました",
 		})
@@ -148,6 +295,7 @@ func CreateBook(c *gin.Context) {
 		Title:    book.Title,
 		ImageUrl: book.ImageUrl,
 		Loanable: book.Loanable,
+		Tags:     bookTagNames(&book),
 		User: struct {
 			ID   uint   `json:"id"`
 			Name string `json:"name"`
@@ -155,6 +303,7 @@ func CreateBook(c *gin.Context) {
 			ID:   user.ID,
 			Name: user.Name,
 		},
+		BookMetadataResponse: newBookMetadataResponse(book),
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
@@ -163,21 +312,26 @@ func CreateBook(c *gin.Context) {
 	})
 }
 
+// UpdateBookRequest の tags を省略した場合はタグを変更しない。
 type UpdateBookRequest struct {
-	Title    string `json:"title" binding:"required"`
-	ImageUrl string `json:"imageUrl" binding:"required"`
-	Loanable bool   `json:"loanable"`
+	Title    string   `json:"title" binding:"required,max=255"`
+	ImageUrl string   `json:"imageUrl" binding:"required,max=255"`
+	Loanable *bool    `json:"loanable"`
+	Tags     []string `json:"tags" binding:"omitempty,max=20,dive,max=64"`
+	BookMetadataRequest
 }
 
 type UpdateBookResponse struct {
-	ID       uint   `json:"id"`
-	Title    string `json:"title"`
-	ImageUrl string `json:"imageUrl"`
-	Loanable bool   `json:"loanable"`
+	ID       uint     `json:"id"`
+	Title    string   `json:"title"`
+	ImageUrl string   `json:"imageUrl"`
+	Loanable bool     `json:"loanable"`
+	Tags     []string `json:"tags"`
 	User     struct {
 		ID   uint   `json:"id"`
 		Name string `json:"name"`
 	} `json:"user"`
+	BookMetadataResponse
 }
 
 func UpdateBook(c *gin.Context) {
@@ -191,7 +345,7 @@ func UpdateBook(c *gin.Context) {
 	}
 
 	var book schema.Book
-	if err := database.Db.Preload("User").First(&book, id).Error; err != nil {
+	if err := database.Db.Preload("User").Scopes(repository.WithAuthors, repository.WithTags).First(&book, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "本が見つかりません",
 		})
@@ -200,9 +354,24 @@ func UpdateBook(c *gin.Context) {
 
 	book.Title = request.Title
 	book.ImageUrl = request.ImageUrl
-	book.Loanable = request.Loanable
+	if request.Loanable != nil {
+		book.Loanable = *request.Loanable
+	}
+
+	authors, message := request.apply(&book)
+	if message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": message,
+		})
+		return
+	}
+
+	tags := bookTagNames(&book)
+	if request.Tags != nil {
+		tags = normalizeTagNames(request.Tags)
+	}
 
-	if err := database.Db.Save(&book).Error; err != nil {
+	if err := repository.SaveBook(&book, authors, tags); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "本の更新に失敗しました",
 		})
@@ -214,6 +383,7 @@ func UpdateBook(c *gin.Context) {
 		Title:    book.Title,
 		ImageUrl: book.ImageUrl,
 		Loanable: book.Loanable,
+		Tags:     bookTagNames(&book),
 		User: struct {
 			ID   uint   `json:"id"`
 			Name string `json:"name"`
@@ -221,6 +391,7 @@ func UpdateBook(c *gin.Context) {
 			ID:   book.User.ID,
 			Name: book.User.Name,
 		},
+		BookMetadataResponse: newBookMetadataResponse(book),
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -246,7 +417,90 @@ func DeleteBook(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, repository.AuditBookDeleted, c.GetUint("user_id"), repository.AuditTargetBook, book.ID, gin.H{"ownerId": book.UserId, "title": book.Title})
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "本の削除に成功しました",
 	})
 }
+
+type UpdateBookLoanableRequest struct {
+	Loanable *bool `json:"loanable" binding:"required"`
+}
+
+func UpdateBookLoanable(c *gin.Context) {
+	id := c.Param("id")
+	var request UpdateBookLoanableRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "無効なリクエストです",
+		})
+		return
+	}
+
+	var book schema.Book
+	if err := database.Db.First(&book, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "本が見つかりません",
+		})
+		return
+	}
+
+	if err := database.Db.Model(&book).Update("loanable", *request.Loanable).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "本の更新に失敗しました",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "本の貸し出し設定を更新しました",
+		"loanable": *request.Loanable,
+	})
+}
+
+type BookOwnerAssignment struct {
+	BookID uint `json:"bookId" binding:"required"`
+	UserID uint `json:"userId" binding:"required"`
+}
+
+type ReassignBookOwnersRequest struct {
+	Assignments []BookOwnerAssignment `json:"assignments" binding:"required,min=1,dive"`
+}
+
+// ReassignBookOwners は既存の本の所有者を付け替える（管理者用）。
+// 以前は全ての本がユーザー #1 で登録されていたため、本来の所有者へ移すために使う。
+func ReassignBookOwners(c *gin.Context) {
+	var request ReassignBookOwnersRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "リクエストボディが不正です",
+		})
+		return
+	}
+
+	owners := make(map[uint]uint, len(request.Assignments))
+	for _, assignment := range request.Assignments {
+		owners[assignment.BookID] = assignment.UserID
+	}
+
+	if err := repository.ReassignBookOwners(owners); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "本またはユーザーが見つかりません",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "所有者の変更に失敗しました",
+		})
+		return
+	}
+
+	recordAudit(c, repository.AuditBooksReassigned, c.GetUint("user_id"), "", 0, gin.H{"assignments": request.Assignments})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "所有者を変更しました",
+		"count":   len(owners),
+	})
+}
@@ -0,0 +1,264 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/bookmeta"
+	"github.com/sayasurvey/golang/api/isbn"
+	"github.com/sayasurvey/golang/api/repository"
+	"github.com/sayasurvey/golang/model/schema"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// languagePattern は ja や en-US のような言語タグ
+var languagePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+var publishedDateLayouts = []string{"2006-01-02", "2006-01", "2006"}
+
+// BookMetadataRequest は本の書誌情報。CreateBookRequest と UpdateBookRequest に埋め込む。
+// 更新時に送られなかった項目を変更しないよう、省略を nil で区別する（著者は nil のスライス）。
+type BookMetadataRequest struct {
+	ISBN          *string  `json:"isbn"`
+	Authors       []string `json:"authors"       binding:"omitempty,max=50,dive,max=255"`
+	Publisher     *string  `json:"publisher"     binding:"omitempty,max=255"`
+	PublishedDate *string  `json:"publishedDate"`
+	PageCount     *int     `json:"pageCount"     binding:"omitempty,min=0"`
+	Language      *string  `json:"language"`
+	Description   *string  `json:"description"`
+}
+
+// apply は書誌情報を検証し、指定された項目だけを book に設定して著者名を返す。
+// 著者が指定されていない場合は book の現在の著者名を返す。
+// 不正な値がある場合は book を変更せずにエラーメッセージを返す。
+func (r BookMetadataRequest) apply(book *schema.Book) ([]string, string) {
+	isbn13 := ""
+	if !blank(r.ISBN) {
+		normalized, err := isbn.Normalize(*r.ISBN)
+		if err != nil {
+			return nil, "ISBN が正しくありません"
+		}
+		isbn13 = normalized
+	}
+
+	publishedDate := trimmed(r.PublishedDate)
+	if publishedDate != "" && !validPublishedDate(publishedDate) {
+		return nil, "出版日は YYYY、YYYY-MM、YYYY-MM-DD のいずれかの形式で指定してください"
+	}
+
+	language := trimmed(r.Language)
+	if language != "" && (len(language) > 16 || !languagePattern.MatchString(language)) {
+		return nil, "言語は ja や en-US のような言語タグで指定してください"
+	}
+
+	if r.ISBN != nil {
+		book.ISBN = isbn13
+	}
+	if r.Publisher != nil {
+		book.Publisher = trimmed(r.Publisher)
+	}
+	if r.PublishedDate != nil {
+		book.PublishedDate = publishedDate
+	}
+	if r.PageCount != nil {
+		book.PageCount = *r.PageCount
+	}
+	if r.Language != nil {
+		book.Language = language
+	}
+	if r.Description != nil {
+		book.Description = trimmed(r.Description)
+	}
+
+	if r.Authors == nil {
+		return bookAuthorNames(book), ""
+	}
+	return bookmeta.NormalizeAuthorNames(r.Authors), ""
+}
+
+// bookAuthorNames は BookAuthors を読み込み済みの book の著者名を表示順に返す。
+func bookAuthorNames(book *schema.Book) []string {
+	names := []string{}
+	for _, bookAuthor := range book.BookAuthors {
+		names = append(names, bookAuthor.Author.Name)
+	}
+	return names
+}
+
+func trimmed(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return strings.TrimSpace(*s)
+}
+
+func blank(s *string) bool {
+	return trimmed(s) == ""
+}
+
+func validPublishedDate(s string) bool {
+	for _, layout := range publishedDateLayouts {
+		if len(s) != len(layout) {
+			continue
+		}
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+type BookAuthorResponse struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// BookMetadataResponse は本の書誌情報。BookResponse と UpdateBookResponse に埋め込む。
+type BookMetadataResponse struct {
+	ISBN          string               `json:"isbn"`
+	ISBN10        string               `json:"isbn10"`
+	Authors       []BookAuthorResponse `json:"authors"`
+	Publisher     string               `json:"publisher"`
+	PublishedDate string               `json:"publishedDate"`
+	PageCount     int                  `json:"pageCount"`
+	Language      string               `json:"language"`
+	Description   string               `json:"description"`
+}
+
+// newBookMetadataResponse は BookAuthors と BookAuthors.Author を読み込み済みの book から書誌情報を作る。
+func newBookMetadataResponse(book schema.Book) BookMetadataResponse {
+	authors := []BookAuthorResponse{}
+	for _, bookAuthor := range book.BookAuthors {
+		authors = append(authors, BookAuthorResponse{
+			ID:   bookAuthor.Author.ID,
+			Name: bookAuthor.Author.Name,
+		})
+	}
+
+	isbn10, _ := isbn.To10(book.ISBN)
+	return BookMetadataResponse{
+		ISBN:          book.ISBN,
+		ISBN10:        isbn10,
+		Authors:       authors,
+		Publisher:     book.Publisher,
+		PublishedDate: book.PublishedDate,
+		PageCount:     book.PageCount,
+		Language:      book.Language,
+		Description:   book.Description,
+	}
+}
+
+var bookMetadataProvider bookmeta.MetadataProvider
+var bookMetadataProviderOnce sync.Once
+
+// getBookMetadataProvider は初回利用時に MetadataProvider を生成する。.env の読み込みより前に環境変数を参照しないため。
+func getBookMetadataProvider() bookmeta.MetadataProvider {
+	bookMetadataProviderOnce.Do(func() {
+		if bookMetadataProvider == nil {
+			bookMetadataProvider = repository.NewCachedMetadataProvider(bookmeta.NewProviderFromEnv())
+		}
+	})
+	return bookMetadataProvider
+}
+
+// lookupBookMetadata は ISBN から書誌情報を取得する。取得できない場合はエラーレスポンスを返して false を返す。
+func lookupBookMetadata(c *gin.Context, rawISBN string) (*bookmeta.Metadata, bool) {
+	isbn13, err := isbn.Normalize(rawISBN)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ISBN が正しくありません"})
+		return nil, false
+	}
+
+	metadata, err := getBookMetadataProvider().Lookup(c.Request.Context(), isbn13)
+	if errors.Is(err, bookmeta.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "書誌情報が見つかりません"})
+		return nil, false
+	}
+	if err != nil {
+		fmt.Println("書誌情報の取得に失敗しました:", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "書誌情報の取得に失敗しました"})
+		return nil, false
+	}
+	return metadata, true
+}
+
+type BookLookupResponse struct {
+	*bookmeta.Metadata
+	ISBN10 string `json:"isbn10"`
+}
+
+// LookupBook は ISBN から書誌情報を取得して返す。本の登録フォームの自動入力用。
+func LookupBook(c *gin.Context) {
+	metadata, ok := lookupBookMetadata(c, c.Query("isbn"))
+	if !ok {
+		return
+	}
+
+	isbn10, _ := isbn.To10(metadata.ISBN)
+	c.JSON(http.StatusOK, gin.H{
+		"book": BookLookupResponse{Metadata: metadata, ISBN10: isbn10},
+	})
+}
+
+// maxBookFieldLength は書名・出版社・表紙画像の URL・著者名の列の長さ
+const maxBookFieldLength = 255
+
+// maxBookAuthors は1冊に登録できる著者の数
+const maxBookAuthors = 50
+
+// fillFrom はリクエストで省略された項目を取得した書誌情報で埋める。
+// 書誌情報の値はリクエストの binding を通らないため、ここで列の長さに収める。
+// 途中で切ると使えない表紙画像の URL と、言語タグとして正しくない言語は使わない。
+func (r *CreateBookRequest) fillFrom(metadata *bookmeta.Metadata) {
+	if r.Title == "" {
+		r.Title = truncateRunes(metadata.Title, maxBookFieldLength)
+	}
+	if r.ImageUrl == "" && utf8.RuneCountInString(metadata.ImageURL) <= maxBookFieldLength {
+		r.ImageUrl = metadata.ImageURL
+	}
+	r.ISBN = &metadata.ISBN
+	if len(bookmeta.NormalizeAuthorNames(r.Authors)) == 0 {
+		r.Authors = fitAuthorNames(metadata.Authors)
+	}
+	if blank(r.Publisher) {
+		publisher := truncateRunes(metadata.Publisher, maxBookFieldLength)
+		r.Publisher = &publisher
+	}
+	if blank(r.PublishedDate) {
+		r.PublishedDate = &metadata.PublishedDate
+	}
+	if r.PageCount == nil || *r.PageCount == 0 {
+		r.PageCount = &metadata.PageCount
+	}
+	if blank(r.Language) && len(metadata.Language) <= 16 && languagePattern.MatchString(metadata.Language) {
+		r.Language = &metadata.Language
+	}
+	if blank(r.Description) {
+		r.Description = &metadata.Description
+	}
+}
+
+// fitAuthorNames は著者数と著者名の長さを上限に収める。
+func fitAuthorNames(names []string) []string {
+	names = bookmeta.NormalizeAuthorNames(names)
+	if len(names) > maxBookAuthors {
+		names = names[:maxBookAuthors]
+	}
+	for i, name := range names {
+		names[i] = truncateRunes(name, maxBookFieldLength)
+	}
+	return names
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:n]))
+}
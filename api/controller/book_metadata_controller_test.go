@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"github.com/sayasurvey/golang/api/bookmeta"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFillFromFitsMetadataToColumns(t *testing.T) {
+	authors := []string{}
+	for i := 0; i < maxBookAuthors+5; i++ {
+		authors = append(authors, strings.Repeat("著", 300)+string(rune('A'+i)))
+	}
+	metadata := &bookmeta.Metadata{
+		ISBN:      "9784000000000",
+		Title:     strings.Repeat("書", 300),
+		ImageURL:  "https://example.com/" + strings.Repeat("a", 300) + ".jpg",
+		Authors:   authors,
+		Publisher: strings.Repeat("社", 300),
+		Language:  "日本語",
+	}
+
+	var request CreateBookRequest
+	request.fillFrom(metadata)
+
+	if n := utf8.RuneCountInString(request.Title); n != maxBookFieldLength {
+		t.Errorf("title length: got %d, want %d", n, maxBookFieldLength)
+	}
+	if n := utf8.RuneCountInString(*request.Publisher); n != maxBookFieldLength {
+		t.Errorf("publisher length: got %d, want %d", n, maxBookFieldLength)
+	}
+	if request.ImageUrl != "" {
+		t.Errorf("切り詰めると使えない表紙画像の URL を設定しています: %s", request.ImageUrl)
+	}
+	if len(request.Authors) != maxBookAuthors {
+		t.Errorf("authors: got %d, want %d", len(request.Authors), maxBookAuthors)
+	}
+	for _, name := range request.Authors {
+		if n := utf8.RuneCountInString(name); n > maxBookFieldLength {
+			t.Errorf("author length: got %d, want <= %d", n, maxBookFieldLength)
+		}
+	}
+	if request.Language != nil {
+		t.Errorf("言語タグでない言語を設定しています: %s", *request.Language)
+	}
+}
+
+func TestFillFromKeepsRequestValues(t *testing.T) {
+	publisher := "指定した出版社"
+	request := CreateBookRequest{
+		Title:    "指定した書名",
+		ImageUrl: "https://example.com/cover.jpg",
+		BookMetadataRequest: BookMetadataRequest{
+			Authors:   []string{"指定した著者"},
+			Publisher: &publisher,
+		},
+	}
+	request.fillFrom(&bookmeta.Metadata{
+		ISBN:        "9784000000000",
+		Title:       "取得した書名",
+		ImageURL:    "https://example.com/other.jpg",
+		Authors:     []string{"取得した著者"},
+		Publisher:   "取得した出版社",
+		PageCount:   320,
+		Language:    "ja",
+		Description: "取得した説明",
+	})
+
+	if request.Title != "指定した書名" || request.ImageUrl != "https://example.com/cover.jpg" || *request.Publisher != publisher {
+		t.Errorf("指定した値が書き換えられています: %+v", request)
+	}
+	if len(request.Authors) != 1 || request.Authors[0] != "指定した著者" {
+		t.Errorf("authors: got %v", request.Authors)
+	}
+	if *request.PageCount != 320 || *request.Language != "ja" || *request.Description != "取得した説明" || *request.ISBN != "9784000000000" {
+		t.Errorf("省略した項目が書誌情報で埋められていません: %+v", request.BookMetadataRequest)
+	}
+}
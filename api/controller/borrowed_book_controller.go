@@ -1,11 +1,12 @@
 package controller
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/sayasurvey/golang/api/repository"
-	"github.com/sayasurvey/golang/api/helper"
+	"github.com/sayasurvey/golang/model/schema"
+	"github.com/sayasurvey/golang/api/pagination"
 	"net/http"
-	"strconv"
 	"time"
 )
 
@@ -28,9 +29,7 @@ type BorrowedBookResponse struct {
 
 type BorrowedBooksResponse struct {
 	BorrowedBooks []BorrowedBookResponse `json:"borrowedBooks"`
-	CurrentPage   int                    `json:"currentPage"`
-	LastPage      int                    `json:"lastPage"`
-	PerPage       int                    `json:"perPage"`
+	pagination.Page
 }
 
 var borrowedBookRepo = repository.NewBorrowedBookRepository()
@@ -52,6 +51,22 @@ func BorrowBook(c *gin.Context) {
 		return
 	}
 
+	if emailVerificationGate() != verificationGateOff {
+		user, err := authRepo.FindUserByID(userID.(uint))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "認証が必要です",
+			})
+			return
+		}
+		if user.VerifiedAt == nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "メールアドレスの確認が完了していません",
+			})
+			return
+		}
+	}
+
 	book, err := borrowedBookRepo.FindBookByID(request.BookID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
@@ -114,6 +129,22 @@ func ReturnBook(c *gin.Context) {
 		return
 	}
 
+	// 返却できるのは借りた本人、本の所有者、管理者のいずれか
+	book, err := borrowedBookRepo.FindBookByID(borrowedBook.BookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "本の情報取得に失敗しました",
+		})
+		return
+	}
+	userID := c.GetUint("user_id")
+	if borrowedBook.UserID != userID && book.UserId != userID && c.GetString("role") != string(schema.AdminRole) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "この貸し出しを返却する権限がありません",
+		})
+		return
+	}
+
 	if err := borrowedBookRepo.ReturnBook(borrowedBook); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "返却処理に失敗しました",
@@ -127,19 +158,12 @@ func ReturnBook(c *gin.Context) {
 }
 
 func GetBorrowedBooks(c *gin.Context) {
-	page := 1
-	perPage := 50
-
-	if pageStr := c.Query("page"); pageStr != "" {
-		if parsedPage, err := strconv.Atoi(pageStr); err == nil && parsedPage > 0 {
-			page = parsedPage
-		}
-	}
-
-	if perPageStr := c.Query("perPage"); perPageStr != "" {
-		if parsedPerPage, err := strconv.Atoi(perPageStr); err == nil && parsedPerPage > 0 {
-			perPage = parsedPerPage
-		}
+	params, err := pagination.Parse(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "cursor が正しくありません",
+		})
+		return
 	}
 
 	userID, exists := c.Get("user_id")
@@ -150,7 +174,13 @@ func GetBorrowedBooks(c *gin.Context) {
 		return
 	}
 
-	borrowedBooks, err := borrowedBookRepo.GetBorrowedBooksByUserID(userID.(uint))
+	borrowedBooks, page, err := borrowedBookRepo.GetBorrowedBooksByUserID(userID.(uint), params)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "cursor が正しくありません",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "貸出情報の取得に失敗しました",
@@ -179,12 +209,8 @@ func GetBorrowedBooks(c *gin.Context) {
 		}
 	}
 
-	paginatedBooks, currentPage, lastPage := helper.Pagination(response, page, perPage)
-
 	c.JSON(http.StatusOK, BorrowedBooksResponse{
-		BorrowedBooks: paginatedBooks,
-		CurrentPage:   currentPage,
-		LastPage:      lastPage,
-		PerPage:       perPage,
+		BorrowedBooks: response,
+		Page:          pagination.NewPage(c, params, page),
 	})
 }
@@ -1,11 +1,12 @@
 package controller
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/sayasurvey/golang/api/repository"
 	"net/http"
 	"strconv"
-	"github.com/sayasurvey/golang/api/helper"
+	"github.com/sayasurvey/golang/api/pagination"
 )
 
 type AddToWishListRequest struct {
@@ -20,9 +21,7 @@ type WishListResponse struct {
 
 type WishListResponseWrapper struct {
 	WishList    []WishListResponse `json:"wishList"`
-	CurrentPage int                `json:"currentPage"`
-	LastPage    int                `json:"lastPage"`
-	PerPage     int                `json:"perPage"`
+	pagination.Page
 }
 
 var wishListRepo = repository.NewBorrowingWishListRepository()
@@ -117,19 +116,12 @@ func RemoveFromWishList(c *gin.Context) {
 }
 
 func GetWishList(c *gin.Context) {
-	page := 1
-	perPage := 50
-
-	if pageStr := c.Query("page"); pageStr != "" {
-		if parsedPage, err := strconv.Atoi(pageStr); err == nil && parsedPage > 0 {
-			page = parsedPage
-		}
-	}
-
-	if perPageStr := c.Query("perPage"); perPageStr != "" {
-		if parsedPerPage, err := strconv.Atoi(perPageStr); err == nil && parsedPerPage > 0 {
-			perPage = parsedPerPage
-		}
+	params, err := pagination.Parse(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "cursor が正しくありません",
+		})
+		return
 	}
 
 	userID, exists := c.Get("user_id")
@@ -140,7 +132,13 @@ func GetWishList(c *gin.Context) {
 		return
 	}
 
-	wishList, err := wishListRepo.GetWishListByUserID(userID.(uint))
+	wishList, page, err := wishListRepo.GetWishListByUserID(userID.(uint), params)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "cursor が正しくありません",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "お気に入りリストの取得に失敗しました",
@@ -167,12 +165,8 @@ func GetWishList(c *gin.Context) {
 		}
 	}
 
-	paginatedWishList, currentPage, lastPage := helper.Pagination(response, page, perPage)
-
 	c.JSON(http.StatusOK, WishListResponseWrapper{
-		WishList:    paginatedWishList,
-		CurrentPage: currentPage,
-		LastPage:    lastPage,
-		PerPage:     perPage,
+		WishList: response,
+		Page:     pagination.NewPage(c, params, page),
 	})
 }
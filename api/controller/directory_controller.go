@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/pagination"
+)
+
+type DirectoryUserResponse struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatarUrl"`
+	Email     string `json:"email,omitempty"`
+	BookCount int64  `json:"bookCount"`
+}
+
+type DirectoryResponse struct {
+	Users []DirectoryUserResponse `json:"users"`
+	pagination.Page
+}
+
+// GetDirectory はログイン中のユーザー向けのユーザー一覧。
+// 公開プロフィールだけを返し、メールアドレスは本人が公開を選んだ場合のみ含める。
+func GetDirectory(c *gin.Context) {
+	params, err := pagination.Parse(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cursor が正しくありません"})
+		return
+	}
+
+	entries, page, err := userRepo.SearchDirectory(c.Query("q"), params)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cursor が正しくありません"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ユーザー一覧の取得に失敗しました"})
+		return
+	}
+
+	response := []DirectoryUserResponse{}
+	for _, entry := range entries {
+		user := DirectoryUserResponse{
+			ID:        entry.ID,
+			Name:      entry.Name,
+			AvatarURL: entry.AvatarURL,
+			BookCount: entry.BookCount,
+		}
+		if entry.EmailVisible {
+			user.Email = entry.Email
+		}
+		response = append(response, user)
+	}
+
+	c.JSON(http.StatusOK, DirectoryResponse{
+		Users: response,
+		Page:  pagination.NewPage(c, params, page),
+	})
+}
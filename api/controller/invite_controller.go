@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/repository"
+	"github.com/sayasurvey/golang/model/schema"
+)
+
+type CreateInviteRequest struct {
+	Note      string `json:"note" binding:"max=255"`
+	MaxUses   int    `json:"maxUses" binding:"omitempty,min=1,max=1000"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+type InviteResponse struct {
+	ID        uint       `json:"id"`
+	Prefix    string     `json:"prefix"`
+	Note      string     `json:"note"`
+	MaxUses   int        `json:"maxUses"`
+	UseCount  int        `json:"useCount"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Usable    bool       `json:"usable"`
+}
+
+type RegistrationSettingRequest struct {
+	InviteRequired *bool    `json:"inviteRequired" binding:"required"`
+	AllowedDomains []string `json:"allowedDomains"`
+}
+
+var inviteRepo = repository.NewInviteRepository()
+
+func toInviteResponse(invite schema.Invite) InviteResponse {
+	expired := invite.ExpiresAt != nil && time.Now().After(*invite.ExpiresAt)
+	return InviteResponse{
+		ID:        invite.ID,
+		Prefix:    invite.Prefix,
+		Note:      invite.Note,
+		MaxUses:   invite.MaxUses,
+		UseCount:  invite.UseCount,
+		CreatedAt: invite.CreatedAt,
+		ExpiresAt: invite.ExpiresAt,
+		Usable:    !expired && invite.UseCount < invite.MaxUses,
+	}
+}
+
+func GetInvites(c *gin.Context) {
+	invites, err := inviteRepo.GetInvites()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "招待コードの取得に失敗しました"})
+		return
+	}
+
+	response := []InviteResponse{}
+	for _, invite := range invites {
+		response = append(response, toInviteResponse(invite))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invites": response,
+	})
+}
+
+// CreateInvite は招待コードを発行する（管理者用）。maxUses を省略した場合は1回だけ使える。
+func CreateInvite(c *gin.Context) {
+	var request CreateInviteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	maxUses := request.MaxUses
+	if maxUses == 0 {
+		maxUses = 1
+	}
+
+	var expiresAt *time.Time
+	if request.ExpiresAt != "" {
+		parsed, err := time.Parse("2006-01-02", request.ExpiresAt)
+		if err != nil || !parsed.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "有効期限は未来の日付を YYYY-MM-DD 形式で入力してください"})
+			return
+		}
+		expiresAt = &parsed
+	}
+
+	invite, code, err := inviteRepo.CreateInvite(c.GetUint("user_id"), request.Note, maxUses, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "招待コードの作成に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditInviteCreated, c.GetUint("user_id"), repository.AuditTargetInvite, invite.ID, gin.H{"maxUses": invite.MaxUses, "expiresAt": invite.ExpiresAt})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "招待コードを作成しました。コードはこの画面でしか表示されません",
+		"code":    code,
+		"invite":  toInviteResponse(*invite),
+	})
+}
+
+func RevokeInvite(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不正な招待コード ID です"})
+		return
+	}
+
+	if err := inviteRepo.RevokeInvite(uint(id)); err != nil {
+		if errors.Is(err, repository.ErrInviteNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "招待コードが見つかりません"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "招待コードの削除に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditInviteRevoked, c.GetUint("user_id"), repository.AuditTargetInvite, uint(id), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "招待コードを削除しました"})
+}
+
+func GetRegistrationSetting(c *gin.Context) {
+	inviteRequired, err := inviteRepo.InviteRequired()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "設定の取得に失敗しました"})
+		return
+	}
+
+	domains, err := inviteRepo.AllowedDomains()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "設定の取得に失敗しました"})
+		return
+	}
+	if domains == nil {
+		domains = []string{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"inviteRequired": inviteRequired,
+		"allowedDomains": domains,
+	})
+}
+
+// UpdateRegistrationSetting は招待制の有無と登録を許可するドメインを設定する（管理者用）。
+// allowedDomains が空の場合はドメインを制限しない。
+func UpdateRegistrationSetting(c *gin.Context) {
+	var request RegistrationSettingRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	for _, domain := range request.AllowedDomains {
+		if strings.ContainsAny(domain, ", ") || !strings.Contains(domain, ".") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不正なドメインです: " + domain})
+			return
+		}
+	}
+
+	if err := inviteRepo.SetInviteRequired(*request.InviteRequired); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "設定の更新に失敗しました"})
+		return
+	}
+	if err := inviteRepo.SetAllowedDomains(request.AllowedDomains); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "設定の更新に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditSettingUpdated, c.GetUint("user_id"), repository.AuditTargetSetting, 0,
+		gin.H{"key": "registration", "inviteRequired": *request.InviteRequired, "allowedDomains": request.AllowedDomains})
+
+	GetRegistrationSetting(c)
+}
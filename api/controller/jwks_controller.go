@@ -0,0 +1,13 @@
+package controller
+
+import (
+	"net/http"
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/jwtkey"
+)
+
+// GetJWKS は他サービスがトークンを検証するための公開鍵を JWK Set 形式で返す。
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwtkey.Current().JWKS())
+}
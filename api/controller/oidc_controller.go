@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/oidc"
+	"github.com/sayasurvey/golang/api/repository"
+)
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+	// InviteCode は招待制の場合に、初めてシングルサインオンでログインする利用者が指定する
+	InviteCode string `json:"inviteCode"`
+}
+
+var oidcRepo = repository.NewOIDCRepository()
+
+var oidcProvider *oidc.Provider
+var oidcProviderOnce sync.Once
+
+func getOIDCProvider() *oidc.Provider {
+	oidcProviderOnce.Do(func() {
+		if oidcProvider == nil {
+			oidcProvider = oidc.NewProviderFromEnv()
+		}
+	})
+	return oidcProvider
+}
+
+// OIDCLogin は認可リクエストを作成し、フロントエンドが遷移する認可 URL を返す。
+func OIDCLogin(c *gin.Context) {
+	provider := getOIDCProvider()
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "シングルサインオンは設定されていません"})
+		return
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ログインの開始に失敗しました"})
+		return
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ログインの開始に失敗しました"})
+		return
+	}
+	verifier, challenge, err := oidc.PKCE()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ログインの開始に失敗しました"})
+		return
+	}
+
+	if err := oidcRepo.CreateAuthRequest(state, nonce, verifier); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ログインの開始に失敗しました"})
+		return
+	}
+
+	authorizationURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, challenge)
+	if err != nil {
+		fmt.Println("OIDC プロバイダーの情報取得に失敗しました:", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "認証プロバイダーに接続できません"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"authorizationUrl": authorizationURL,
+	})
+}
+
+// OIDCCallback はフロントエンドが受け取った認可コードを検証し、通常のログインと同じトークンを返す。
+func OIDCCallback(c *gin.Context) {
+	provider := getOIDCProvider()
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "シングルサインオンは設定されていません"})
+		return
+	}
+
+	var request OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	authRequest, err := oidcRepo.ConsumeAuthRequest(request.State)
+	if err != nil {
+		if errors.Is(err, repository.ErrOIDCAuthRequestInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ログインの有効期限が切れています。もう一度お試しください"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ログインに失敗しました"})
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), request.Code, authRequest.CodeVerifier, authRequest.Nonce)
+	if err != nil {
+		fmt.Println("OIDC の認可コード交換に失敗しました:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "シングルサインオンに失敗しました"})
+		return
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "確認済みのメールアドレスが取得できませんでした"})
+		return
+	}
+
+	user, err := oidcRepo.FindOrCreateUser(provider.Issuer, claims.Subject, claims.Email, claims.Name, request.InviteCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEmailDomainRejected):
+			c.JSON(http.StatusForbidden, gin.H{"error": "このメールアドレスのドメインでは登録できません"})
+			return
+		case errors.Is(err, repository.ErrInviteRequired):
+			c.JSON(http.StatusForbidden, gin.H{"error": "登録には招待コードが必要です"})
+			return
+		case errors.Is(err, repository.ErrInviteInvalid):
+			c.JSON(http.StatusForbidden, gin.H{"error": "招待コードが無効か有効期限が切れています"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ユーザーの連携に失敗しました"})
+		return
+	}
+
+	completeLogin(c, user)
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/mailer"
+	"github.com/sayasurvey/golang/api/passwordpolicy"
+	"github.com/sayasurvey/golang/api/repository"
+	"github.com/sayasurvey/golang/model/schema"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+var passwordResetRepo = repository.NewPasswordResetRepository()
+var mail mailer.Mailer
+var mailOnce sync.Once
+
+// sendMail は初回送信時に Mailer を取得する。.env の読み込みより前に環境変数を参照しないため。
+func sendMail(msg mailer.Message) error {
+	mailOnce.Do(func() {
+		if mail == nil {
+			mail = mailer.Current()
+		}
+	})
+	return mail.Send(msg)
+}
+
+func ForgotPassword(c *gin.Context) {
+	var request ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	// メールアドレスの登録有無が分からないよう、結果に関わらず同じレスポンスを返す
+	response := gin.H{"message": "パスワード再設定用のメールを送信しました"}
+
+	user, err := authRepo.FindUserByEmail(request.Email)
+	if err != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// 送信の失敗もレスポンスに出すと登録済みのアドレスだと分かるため、記録だけして同じレスポンスを返す
+	if err := sendPasswordResetEmail(user); err != nil {
+		fmt.Println("パスワード再設定メールの送信に失敗しました:", err)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	recordAudit(c, repository.AuditPasswordResetRequested, 0, repository.AuditTargetUser, user.ID, nil)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// sendPasswordResetEmail は再設定用のトークンを発行し、リンクをメールで送る。
+func sendPasswordResetEmail(user *schema.User) error {
+	token, err := passwordResetRepo.CreateResetToken(user.ID)
+	if err != nil {
+		return err
+	}
+
+	resetURL := fmt.Sprintf("%s/password/reset?token=%s", os.Getenv("NEXT_PUBLIC_APP_URL"), url.QueryEscape(token))
+	return sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "パスワード再設定のご案内",
+		Body: fmt.Sprintf("%s 様\n\n以下のリンクから%d分以内にパスワードを再設定してください。\n%s\n\nお心当たりがない場合はこのメールを破棄してください。\n",
+			user.Name, int(repository.PasswordResetTokenTTL.Minutes()), resetURL),
+	})
+}
+
+func ResetPassword(c *gin.Context) {
+	var request ResetPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	if !checkPasswordPolicy(c, request.Password) {
+		return
+	}
+
+	user, err := passwordResetRepo.ResetPassword(request.Token, request.Password)
+	if err != nil {
+		if errors.Is(err, repository.ErrPasswordResetTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "トークンが無効か有効期限が切れています"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "パスワードの再設定に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditPasswordReset, user.ID, repository.AuditTargetUser, user.ID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "パスワードを再設定しました"})
+}
+
+// checkPasswordPolicy はパスワードが要件を満たすか確認し、満たさない場合は
+// ルールごとのエラーコードを付けて 400 を返す。
+func checkPasswordPolicy(c *gin.Context, password string) bool {
+	violations, err := passwordpolicy.Current().Validate(password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "パスワードの確認に失敗しました"})
+		return false
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "パスワードが要件を満たしていません",
+			"violations": violations,
+		})
+		return false
+	}
+	return true
+}
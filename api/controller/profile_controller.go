@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/repository"
+	"github.com/sayasurvey/golang/model/schema"
+)
+
+type UpdateProfileRequest struct {
+	Name         *string `json:"name"`
+	Email        *string `json:"email" binding:"omitempty,email"`
+	AvatarURL    *string `json:"avatarUrl" binding:"omitempty,url,max=255"`
+	EmailVisible *bool   `json:"emailVisible"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required"`
+}
+
+type MeResponse struct {
+	ID               uint       `json:"id"`
+	Name             string     `json:"name"`
+	Email            string     `json:"email"`
+	Role             string     `json:"role"`
+	Verified         bool       `json:"verified"`
+	VerifiedAt       *time.Time `json:"verifiedAt"`
+	PendingEmail     string     `json:"pendingEmail,omitempty"`
+	AvatarURL        string     `json:"avatarUrl"`
+	EmailVisible     bool       `json:"emailVisible"`
+	TwoFactorEnabled bool       `json:"twoFactorEnabled"`
+	CreatedAt        time.Time  `json:"createdAt"`
+}
+
+var profileRepo = repository.NewProfileRepository()
+
+func respondWithMe(c *gin.Context, user *schema.User) {
+	twoFactorEnabled, err := twoFactorRepo.IsEnabled(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ユーザ情報の取得に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": MeResponse{
+			ID:               user.ID,
+			Name:             user.Name,
+			Email:            user.Email,
+			Role:             string(user.Role),
+			Verified:         user.VerifiedAt != nil,
+			VerifiedAt:       user.VerifiedAt,
+			PendingEmail:     user.PendingEmail,
+			AvatarURL:        user.AvatarURL,
+			EmailVisible:     user.EmailVisible,
+			TwoFactorEnabled: twoFactorEnabled,
+			CreatedAt:        user.CreatedAt,
+		},
+	})
+}
+
+func GetMe(c *gin.Context) {
+	user, err := authRepo.FindUserByID(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "認証が必要です"})
+		return
+	}
+
+	respondWithMe(c, user)
+}
+
+// UpdateMe はプロフィールを変更する。emailVisible はユーザー一覧でメールアドレスを公開するかどうか。
+// メールアドレスはすぐには変更せず、変更後のアドレスに届いた確認リンクが開かれた時点で切り替える。
+func UpdateMe(c *gin.Context) {
+	var request UpdateProfileRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	user, err := authRepo.FindUserByID(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "認証が必要です"})
+		return
+	}
+
+	update := repository.ProfileUpdate{
+		AvatarURL:    request.AvatarURL,
+		EmailVisible: request.EmailVisible,
+	}
+	if request.Name != nil {
+		name := strings.TrimSpace(*request.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "名前を入力してください"})
+			return
+		}
+		update.Name = &name
+	}
+
+	if err := profileRepo.UpdateProfile(user.ID, update); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "プロフィールの更新に失敗しました"})
+		return
+	}
+	if update.Name != nil {
+		user.Name = *update.Name
+	}
+	if update.AvatarURL != nil {
+		user.AvatarURL = *update.AvatarURL
+	}
+	if update.EmailVisible != nil {
+		user.EmailVisible = *update.EmailVisible
+	}
+
+	if request.Email != nil {
+		email := strings.TrimSpace(*request.Email)
+		if email == user.Email {
+			// 現在のアドレスに戻した場合は確認待ちの変更を取り消す
+			if err := profileRepo.CancelEmailChange(user.ID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "プロフィールの更新に失敗しました"})
+				return
+			}
+			user.PendingEmail = ""
+		} else {
+			if err := profileRepo.RequestEmailChange(user.ID, email); err != nil {
+				if errors.Is(err, repository.ErrEmailTaken) {
+					c.JSON(http.StatusConflict, gin.H{"error": "このメールアドレスは既に使用されています"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "プロフィールの更新に失敗しました"})
+				return
+			}
+			user.PendingEmail = email
+			recordAudit(c, repository.AuditEmailChangeRequested, user.ID, repository.AuditTargetUser, user.ID, nil)
+
+			// 変更は保存済みなので、送信に失敗しても再度 PATCH すれば確認メールを送り直せる
+			if err := sendVerificationEmail(user, email); err != nil {
+				fmt.Println("確認メールの送信に失敗しました:", err)
+			}
+		}
+	}
+
+	respondWithMe(c, user)
+}
+
+// ChangePassword は現在のパスワードを確認してから新しいパスワードに変更する。
+// 変更後はこの端末以外のセッションと、全ての API キーを失効させる。
+func ChangePassword(c *gin.Context) {
+	var request ChangePasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	if !checkPasswordPolicy(c, request.NewPassword) {
+		return
+	}
+
+	err := profileRepo.ChangePassword(c.GetUint("user_id"), c.GetUint("session_id"), request.CurrentPassword, request.NewPassword)
+	if err != nil {
+		if errors.Is(err, repository.ErrCurrentPasswordMismatch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "現在のパスワードが正しくありません"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "パスワードの変更に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditPasswordChanged, c.GetUint("user_id"), repository.AuditTargetUser, c.GetUint("user_id"), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "パスワードを変更しました。他の端末からはログアウトされます"})
+}
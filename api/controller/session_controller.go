@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/repository"
+)
+
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	Current    bool      `json:"current"`
+}
+
+func GetSessions(c *gin.Context) {
+	sessions, err := sessionRepo.GetActiveSessions(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "セッション一覧の取得に失敗しました"})
+		return
+	}
+
+	currentSessionID := c.GetUint("session_id")
+	response := []SessionResponse{}
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			Current:    session.ID == currentSessionID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": response,
+	})
+}
+
+func RevokeSession(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不正なセッションIDです"})
+		return
+	}
+
+	if err := sessionRepo.RevokeSession(c.GetUint("user_id"), uint(id)); err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "セッションが見つかりません"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "セッションの削除に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditSessionRevoked, c.GetUint("user_id"), repository.AuditTargetSession, uint(id), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "セッションからログアウトしました"})
+}
+
+// RevokeOtherSessions は現在のセッション以外の全てのセッションからログアウトする。
+func RevokeOtherSessions(c *gin.Context) {
+	revoked, err := sessionRepo.RevokeOtherSessions(c.GetUint("user_id"), c.GetUint("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "セッションの削除に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditSessionRevoked, c.GetUint("user_id"), repository.AuditTargetUser, c.GetUint("user_id"), gin.H{"count": revoked, "keptSessionId": c.GetUint("session_id")})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "他の端末からログアウトしました",
+		"count":   revoked,
+	})
+}
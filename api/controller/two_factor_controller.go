@@ -0,0 +1,321 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/repository"
+	"github.com/sayasurvey/golang/api/totp"
+	"github.com/sayasurvey/golang/model/schema"
+)
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactorRequest の password を省略した場合は、直前のログインで本人確認する。
+type DisableTwoFactorRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type TwoFactorSettingRequest struct {
+	RequiredRoles []schema.Role `json:"requiredRoles"`
+}
+
+var twoFactorRepo = repository.NewTwoFactorRepository()
+
+// completeLogin は本人確認の済んだユーザーにトークンを発行する。停止中のユーザーは拒否する。
+// 二要素認証が有効な場合はトークンの代わりにチャレンジトークンを返し、/api/login/2fa でのコード確認を求める。
+func completeLogin(c *gin.Context, user *schema.User) {
+	if user.SuspendedAt != nil {
+		recordAudit(c, repository.AuditLoginFailed, user.ID, "", 0, gin.H{"reason": "suspended"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "このアカウントは利用停止中です"})
+		return
+	}
+
+	enabled, err := twoFactorRepo.IsEnabled(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ログインに失敗しました"})
+		return
+	}
+	if !enabled {
+		respondWithTokens(c, user)
+		return
+	}
+
+	challengeToken, err := twoFactorRepo.GenerateChallengeToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "トークンの生成に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"twoFactorRequired": true,
+		"challengeToken":    challengeToken,
+	})
+}
+
+func LoginTwoFactor(c *gin.Context) {
+	var request TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	user, err := twoFactorRepo.ParseChallengeToken(request.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "ログインの有効期限が切れています。もう一度ログインしてください"})
+		return
+	}
+
+	// コードの総当たりもパスワードと同じ回数制限で止める
+	throttle := getLoginThrottle()
+	accountKey := repository.AccountAttemptKey(user.Email)
+	ipKey := repository.IPAttemptKey(c.ClientIP())
+
+	retryAfter, err := throttle.RetryAfter(accountKey, ipKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ログインに失敗しました"})
+		return
+	}
+	if retryAfter > 0 {
+		recordAudit(c, repository.AuditLoginLocked, user.ID, "", 0, nil)
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "認証コードが正しくありません"})
+		return
+	}
+
+	if err := twoFactorRepo.Verify(user.ID, request.Code); err != nil {
+		if errors.Is(err, repository.ErrTwoFactorCodeInvalid) || errors.Is(err, repository.ErrTwoFactorNotEnabled) {
+			if err := throttle.RecordFailure(accountKey, ipKey); err != nil {
+				fmt.Println("ログイン失敗の記録に失敗しました:", err)
+			}
+			recordAudit(c, repository.AuditLoginFailed, user.ID, "", 0, gin.H{"reason": "two_factor"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "認証コードが正しくありません"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ログインに失敗しました"})
+		return
+	}
+
+	if err := throttle.Reset(accountKey); err != nil {
+		fmt.Println("ログイン失敗記録のリセットに失敗しました:", err)
+	}
+
+	// チャレンジトークンの発行後に停止された場合
+	if user.SuspendedAt != nil {
+		recordAudit(c, repository.AuditLoginFailed, user.ID, "", 0, gin.H{"reason": "suspended"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "このアカウントは利用停止中です"})
+		return
+	}
+
+	respondWithTokens(c, user)
+}
+
+// verifyTwoFactorCode はログイン中のユーザーの認証コードを確認し、失敗した場合はエラーレスポンスを書いて false を返す。
+// セッションを盗まれた場合にコードを総当たりされないよう、LoginTwoFactor と同じ回数制限を適用する。
+func verifyTwoFactorCode(c *gin.Context, user *schema.User, code string) bool {
+	throttle := getLoginThrottle()
+	accountKey := repository.AccountAttemptKey(user.Email)
+	ipKey := repository.IPAttemptKey(c.ClientIP())
+
+	retryAfter, err := throttle.RetryAfter(accountKey, ipKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "認証コードの確認に失敗しました"})
+		return false
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "認証コードの入力に続けて失敗したため、しばらくしてからもう一度お試しください"})
+		return false
+	}
+
+	if err := twoFactorRepo.Verify(user.ID, code); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrTwoFactorCodeInvalid):
+			if err := throttle.RecordFailure(accountKey, ipKey); err != nil {
+				fmt.Println("認証コードの失敗の記録に失敗しました:", err)
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "認証コードが正しくありません"})
+		case errors.Is(err, repository.ErrTwoFactorNotEnabled):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "二要素認証は有効になっていません"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "認証コードの確認に失敗しました"})
+		}
+		return false
+	}
+
+	if err := throttle.Reset(accountKey); err != nil {
+		fmt.Println("ログイン失敗記録のリセットに失敗しました:", err)
+	}
+	return true
+}
+
+func SetupTwoFactor(c *gin.Context) {
+	secret, err := twoFactorRepo.BeginEnrollment(c.GetUint("user_id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrTwoFactorAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "二要素認証は既に有効です"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "二要素認証の登録に失敗しました"})
+		return
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "cbm"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":          secret,
+		"provisioningUri": totp.ProvisioningURI(issuer, c.GetString("email"), secret),
+	})
+}
+
+func EnableTwoFactor(c *gin.Context) {
+	var request TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	recoveryCodes, err := twoFactorRepo.Enable(c.GetUint("user_id"), c.GetUint("session_id"), request.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrTwoFactorCodeInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "認証コードが正しくありません"})
+		case errors.Is(err, repository.ErrTwoFactorNotEnabled):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "先に二要素認証の登録を開始してください"})
+		case errors.Is(err, repository.ErrTwoFactorAlreadyEnabled):
+			c.JSON(http.StatusConflict, gin.H{"error": "二要素認証は既に有効です"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "二要素認証の有効化に失敗しました"})
+		}
+		return
+	}
+
+	recordAudit(c, repository.AuditTwoFactorEnabled, c.GetUint("user_id"), repository.AuditTargetUser, c.GetUint("user_id"), nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "二要素認証を有効にしました。リカバリーコードは安全な場所に保管してください",
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+func DisableTwoFactor(c *gin.Context) {
+	var request DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	user, err := authRepo.FindUserByID(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "認証が必要です"})
+		return
+	}
+
+	// パスワードを持たないシングルサインオンの利用者は、ログインし直せば無効にできる
+	if !confirmPasswordOrRecentLogin(c, user, request.Password, "二要素認証を無効に") {
+		return
+	}
+
+	if !verifyTwoFactorCode(c, user, request.Code) {
+		return
+	}
+
+	if err := twoFactorRepo.Disable(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "二要素認証の無効化に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditTwoFactorDisabled, user.ID, repository.AuditTargetUser, user.ID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "二要素認証を無効にしました"})
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var request TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	user, err := authRepo.FindUserByID(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "認証が必要です"})
+		return
+	}
+
+	if !verifyTwoFactorCode(c, user, request.Code) {
+		return
+	}
+
+	recoveryCodes, err := twoFactorRepo.RegenerateRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "リカバリーコードの再発行に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditRecoveryCodesRenewed, user.ID, repository.AuditTargetUser, user.ID, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+func GetTwoFactorSetting(c *gin.Context) {
+	roles, err := twoFactorRepo.RequiredRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "設定の取得に失敗しました"})
+		return
+	}
+	if roles == nil {
+		roles = []schema.Role{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"requiredRoles": roles,
+	})
+}
+
+// UpdateTwoFactorSetting は二要素認証を必須にするロールを設定する（管理者用）。
+// 必須のロールでも二要素認証を有効にしていないユーザーには、そのロールの権限を与えない。
+func UpdateTwoFactorSetting(c *gin.Context) {
+	var request TwoFactorSettingRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	for _, role := range request.RequiredRoles {
+		if !isValidRole(role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不正なロールです: " + string(role)})
+			return
+		}
+	}
+
+	if err := twoFactorRepo.SetRequiredRoles(request.RequiredRoles); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "設定の更新に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditSettingUpdated, c.GetUint("user_id"), repository.AuditTargetSetting, 0,
+		gin.H{"key": repository.SettingTwoFactorRequiredRoles, "requiredRoles": request.RequiredRoles})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "設定を更新しました",
+		"requiredRoles": request.RequiredRoles,
+	})
+}
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/repository"
+	"github.com/sayasurvey/golang/model/schema"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ログイン中の認証コードの確認も、ロック中は認証コードを確認せずに拒否する
+func TestVerifyTwoFactorCodeWhileLocked(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := &schema.User{Email: "user@example.com"}
+	user.ID = 1
+
+	previous := loginThrottle
+	loginThrottle = repository.NewLoginThrottle(repository.NewMemoryLoginAttemptStore())
+	t.Cleanup(func() { loginThrottle = previous })
+	for i := 0; i < loginThrottle.MaxAccountFailures; i++ {
+		if err := loginThrottle.RecordFailure(repository.AccountAttemptKey(user.Email), repository.IPAttemptKey("192.0.2.1")); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/me/2fa/recovery-codes", nil)
+
+	if verifyTwoFactorCode(c, user, "123456") {
+		t.Fatal("ロック中に認証コードを確認しています")
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("got %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After がありません")
+	}
+}
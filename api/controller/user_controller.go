@@ -0,0 +1,240 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/api/pagination"
+	"github.com/sayasurvey/golang/api/repository"
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+)
+
+type UserResponse struct {
+	ID               uint       `json:"id"`
+	Name             string     `json:"name"`
+	Email            string     `json:"email"`
+	Role             string     `json:"role"`
+	Verified         bool       `json:"verified"`
+	Suspended        bool       `json:"suspended"`
+	SuspendedAt      *time.Time `json:"suspendedAt"`
+	SuspensionReason string     `json:"suspensionReason,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+}
+
+type UsersResponse struct {
+	Users []UserResponse `json:"users"`
+	pagination.Page
+}
+
+type UpdateUserRoleRequest struct {
+	Role schema.Role `json:"role" binding:"required"`
+}
+
+type SuspendUserRequest struct {
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+var userRepo = repository.NewUserRepository()
+
+func newUserResponse(user *schema.User) UserResponse {
+	return UserResponse{
+		ID:               user.ID,
+		Name:             user.Name,
+		Email:            user.Email,
+		Role:             string(user.Role),
+		Verified:         user.VerifiedAt != nil,
+		Suspended:        user.SuspendedAt != nil,
+		SuspendedAt:      user.SuspendedAt,
+		SuspensionReason: user.SuspensionReason,
+		CreatedAt:        user.CreatedAt,
+	}
+}
+
+// GetUsers はユーザーを検索する（管理者用）。
+// q で名前・メールアドレスの部分一致、role と status（active / suspended）で絞り込む。
+func GetUsers(c *gin.Context) {
+	params, err := pagination.Parse(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cursor が正しくありません"})
+		return
+	}
+
+	search := repository.UserSearch{
+		Query:  c.Query("q"),
+		Role:   schema.Role(c.Query("role")),
+		Status: repository.UserStatus(c.Query("status")),
+	}
+	if search.Role != "" && !isValidRole(search.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不正なロールです: " + string(search.Role)})
+		return
+	}
+	if search.Status != "" && search.Status != repository.UserStatusActive && search.Status != repository.UserStatusSuspended {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不正な状態です: " + string(search.Status)})
+		return
+	}
+
+	users, page, err := userRepo.SearchUsers(search, params)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cursor が正しくありません"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ユーザー一覧の取得に失敗しました"})
+		return
+	}
+
+	response := []UserResponse{}
+	for i := range users {
+		response = append(response, newUserResponse(&users[i]))
+	}
+
+	c.JSON(http.StatusOK, UsersResponse{
+		Users: response,
+		Page:  pagination.NewPage(c, params, page),
+	})
+}
+
+func GetUser(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": newUserResponse(user)})
+}
+
+// UpdateUserRole はロールを変更する（管理者用）。変更したユーザーは再ログインが必要になる。
+func UpdateUserRole(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	var request UpdateUserRoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+	if !isValidRole(request.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不正なロールです: " + string(request.Role)})
+		return
+	}
+
+	if err := userRepo.UpdateRole(user.ID, request.Role); err != nil {
+		if errors.Is(err, repository.ErrLastAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": "管理者が1人もいなくなるため変更できません"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ロールの変更に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditUserRoleChanged, c.GetUint("user_id"), repository.AuditTargetUser, user.ID, gin.H{"from": user.Role, "to": request.Role})
+
+	user.Role = request.Role
+	c.JSON(http.StatusOK, gin.H{
+		"message": "ロールを変更しました",
+		"user":    newUserResponse(user),
+	})
+}
+
+// SuspendUser はアカウントを利用停止にする（管理者用）。全ての端末からログアウトさせる。
+func SuspendUser(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	var request SuspendUserRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "リクエストボディが不正です"})
+		return
+	}
+
+	if user.ID == c.GetUint("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "自分自身のアカウントは停止できません"})
+		return
+	}
+
+	if err := userRepo.Suspend(user.ID, request.Reason); err != nil {
+		if errors.Is(err, repository.ErrLastAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": "管理者が1人もいなくなるため停止できません"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "アカウントの停止に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditUserSuspended, c.GetUint("user_id"), repository.AuditTargetUser, user.ID, gin.H{"reason": request.Reason})
+
+	c.JSON(http.StatusOK, gin.H{"message": "アカウントを停止しました"})
+}
+
+func ReactivateUser(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	if err := userRepo.Reactivate(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "アカウントの再開に失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditUserReactivated, c.GetUint("user_id"), repository.AuditTargetUser, user.ID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "アカウントを再開しました"})
+}
+
+// ForcePasswordReset は現在のパスワードを無効にし、再設定メールを送る（管理者用）。
+func ForcePasswordReset(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	if err := userRepo.ForcePasswordReset(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "パスワードのリセットに失敗しました"})
+		return
+	}
+
+	recordAudit(c, repository.AuditUserPasswordReset, c.GetUint("user_id"), repository.AuditTargetUser, user.ID, nil)
+
+	// パスワードは無効化済みなので、送信に失敗しても利用者は /api/password/forgot から再設定できる
+	if err := sendPasswordResetEmail(user); err != nil {
+		fmt.Println("パスワード再設定メールの送信に失敗しました:", err)
+		c.JSON(http.StatusOK, gin.H{"message": "パスワードを無効にしましたが、再設定メールの送信に失敗しました"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "パスワードを無効にし、再設定メールを送信しました"})
+}
+
+// findUserParam は :id のユーザーを取得する。見つからない場合はエラーレスポンスを書いて false を返す。
+func findUserParam(c *gin.Context) (*schema.User, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不正なユーザーIDです"})
+		return nil, false
+	}
+
+	user, err := authRepo.FindUserByID(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ユーザーが見つかりません"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ユーザーの取得に失敗しました"})
+		return nil, false
+	}
+	return user, true
+}
+
+func isValidRole(role schema.Role) bool {
+	return role == schema.AdminRole || role == schema.UserRole
+}
@@ -0,0 +1,90 @@
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalid = errors.New("invalid ISBN")
+
+// Normalize はハイフンや空白を取り除いて ISBN-10 / ISBN-13 のチェックディジットを検証し、ISBN-13 を返す。
+// ISBN-10 は 978 を付けた ISBN-13 に変換する。
+func Normalize(s string) (string, error) {
+	s = strings.ToUpper(strings.NewReplacer("-", "", " ", "", "‐", "", "−", "").Replace(strings.TrimSpace(s)))
+	s = strings.TrimPrefix(s, "ISBN")
+	s = strings.TrimPrefix(s, ":")
+
+	switch len(s) {
+	case 10:
+		if !valid10(s) {
+			return "", ErrInvalid
+		}
+		body := "978" + s[:9]
+		return body + string(checkDigit13(body)), nil
+	case 13:
+		if !valid13(s) {
+			return "", ErrInvalid
+		}
+		return s, nil
+	default:
+		return "", ErrInvalid
+	}
+}
+
+// To10 は 978 で始まる ISBN-13 を ISBN-10 に変換する。979 で始まるものは ISBN-10 を持たない。
+func To10(isbn13 string) (string, bool) {
+	if len(isbn13) != 13 || !strings.HasPrefix(isbn13, "978") {
+		return "", false
+	}
+	body := isbn13[3:12]
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return body + "X", true
+	}
+	return body + string(rune('0'+check)), true
+}
+
+func valid10(s string) bool {
+	sum := 0
+	for i := 0; i < 10; i++ {
+		var digit int
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			digit = int(s[i] - '0')
+		case s[i] == 'X' && i == 9:
+			digit = 10
+		default:
+			return false
+		}
+		sum += digit * (10 - i)
+	}
+	return sum%11 == 0
+}
+
+func valid13(s string) bool {
+	for i := 0; i < 13; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	if !strings.HasPrefix(s, "978") && !strings.HasPrefix(s, "979") {
+		return false
+	}
+	return checkDigit13(s[:12]) == s[12]
+}
+
+func checkDigit13(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		digit := int(body[i] - '0')
+		if i%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return byte('0' + (10-sum%10)%10)
+}
@@ -0,0 +1,96 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"isbn-13", "9784101001616", "9784101001616"},
+		{"isbn-13 with hyphens", "978-4-10-100161-6", "9784101001616"},
+		{"isbn-13 with spaces", " 978 4 10 100161 6 ", "9784101001616"},
+		{"isbn-13 with prefix", "ISBN: 978-4-10-100161-6", "9784101001616"},
+		{"isbn-13 starting with 979", "979-10-90636-07-1", "9791090636071"},
+		{"isbn-10", "4101001618", "9784101001616"},
+		{"isbn-10 with hyphens", "4-10-100161-8", "9784101001616"},
+		{"isbn-10 with X", "0-8044-2957-X", "9780804429573"},
+		{"isbn-10 with lowercase x", "080442957x", "9780804429573"},
+		{"isbn-10 with other hyphens", "0‐306‐40615−2", "9780306406157"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.input)
+			if err != nil {
+				t.Fatalf("Normalize(%q): %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q): got %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"isbn-13 with wrong check digit", "9784101001617"},
+		{"isbn-13 with other prefix", "9771234567003"},
+		{"isbn-13 with letter", "97841010016A6"},
+		{"isbn-10 with wrong check digit", "4101001617"},
+		{"isbn-10 with X not last", "X804429570"},
+		{"isbn-10 with wrong X", "030640615X"},
+		{"too short", "410100161"},
+		{"too long", "97841010016160"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := Normalize(tt.input); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Normalize(%q): got %q, %v, want %v", tt.input, got, err, ErrInvalid)
+			}
+		})
+	}
+}
+
+func TestTo10(t *testing.T) {
+	tests := []struct {
+		isbn13 string
+		want   string
+		ok     bool
+	}{
+		{"9784101001616", "4101001618", true},
+		{"9780804429573", "080442957X", true},
+		{"9780306406157", "0306406152", true},
+		{"9791090636071", "", false},
+		{"978410100161", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := To10(tt.isbn13)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("To10(%s): got %q, %v, want %q, %v", tt.isbn13, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// ISBN-10 から ISBN-13 に変換して戻すと元の ISBN-10 になる
+func TestRoundTrip(t *testing.T) {
+	for _, isbn10 := range []string{"4101001618", "080442957X", "0306406152", "4003101014"} {
+		isbn13, err := Normalize(isbn10)
+		if err != nil {
+			t.Fatalf("Normalize(%s): %v", isbn10, err)
+		}
+		if got, ok := To10(isbn13); !ok || got != isbn10 {
+			t.Errorf("To10(%s): got %q, %v, want %s", isbn13, got, ok, isbn10)
+		}
+	}
+}
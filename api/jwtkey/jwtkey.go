@@ -0,0 +1,251 @@
+package jwtkey
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key は kid で識別される署名鍵または検証専用鍵。
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Private は検証専用（公開鍵のみ）の場合 nil
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySet は署名に使う鍵1つと、検証に使う全ての鍵を保持する。
+// ローテーション時は新しい鍵を追加して署名鍵を切り替え、古い鍵は発行済みトークンが
+// 期限切れになるまで検証用に残しておく。
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+	// hmacSecret は鍵ディレクトリ未設定時の開発用フォールバック
+	hmacSecret []byte
+}
+
+var current atomic.Pointer[KeySet]
+
+// Init は環境変数から KeySet を読み込む。
+// JWT_KEY_DIR が未設定の場合は SECRET_KEY による HS256 にフォールバックする。
+func Init() error {
+	set, err := LoadFromEnv()
+	if err != nil {
+		return err
+	}
+	current.Store(set)
+	return nil
+}
+
+// Current は Init で読み込んだ KeySet を返す。未初期化の場合は環境変数から読み込む。
+func Current() *KeySet {
+	if set := current.Load(); set != nil {
+		return set
+	}
+	set, err := LoadFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	current.CompareAndSwap(nil, set)
+	return current.Load()
+}
+
+func LoadFromEnv() (*KeySet, error) {
+	dir := os.Getenv("JWT_KEY_DIR")
+	if dir == "" {
+		return NewHMACKeySet([]byte(os.Getenv("SECRET_KEY"))), nil
+	}
+	return LoadDir(dir, os.Getenv("JWT_SIGNING_KID"))
+}
+
+func NewHMACKeySet(secret []byte) *KeySet {
+	return &KeySet{keys: map[string]*Key{}, hmacSecret: secret}
+}
+
+// LoadDir は dir 配下の *.pem を読み込む。ファイル名（拡張子を除く）が kid になる。
+// 秘密鍵（PKCS#8 / PKCS#1）は署名と検証、公開鍵（PKIX）は検証のみに使う。
+// signingKID が空の場合は秘密鍵のうち kid が辞書順で最後のものを署名に使うため、
+// kid には 2026-10-01 のような日付を付けておくとよい。
+func LoadDir(dir, signingKID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	set := &KeySet{keys: map[string]*Key{}}
+	var privateIDs []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := parseKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		set.keys[kid] = key
+		if key.Private != nil {
+			privateIDs = append(privateIDs, kid)
+		}
+	}
+
+	if signingKID == "" {
+		if len(privateIDs) == 0 {
+			return nil, errors.New("jwtkey: no private key found in " + dir)
+		}
+		sort.Strings(privateIDs)
+		signingKID = privateIDs[len(privateIDs)-1]
+	}
+
+	signing, ok := set.keys[signingKID]
+	if !ok || signing.Private == nil {
+		return nil, fmt.Errorf("jwtkey: signing key %q not found in %s", signingKID, dir)
+	}
+	set.signing = signing
+	return set, nil
+}
+
+func parseKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, Private: k, Public: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, Public: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, Private: k, Public: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, Public: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// Sign は署名鍵でクレームに署名し、ヘッダーに kid を付与する。
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if s.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.hmacSecret)
+	}
+
+	token := jwt.NewWithClaims(s.signing.Method, claims)
+	token.Header["kid"] = s.signing.ID
+	return token.SignedString(s.signing.Private)
+}
+
+// Keyfunc は jwt.Parse に渡す検証鍵の解決関数。
+// kid に対応する鍵がない場合や、鍵と alg が一致しない場合は拒否する。
+func (s *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if s.signing == nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return s.hmacSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, jwt.ErrTokenUnverifiable
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.Public, nil
+}
+
+// Parse は KeySet の鍵でトークンを検証する。
+func (s *KeySet) Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, s.Keyfunc, jwt.WithValidMethods(s.validMethods()))
+}
+
+func (s *KeySet) validMethods() []string {
+	if s.signing == nil {
+		return []string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodHS384.Alg(), jwt.SigningMethodHS512.Alg()}
+	}
+	return []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS は検証に使う全ての公開鍵を JWK Set 形式で返す。HS256 フォールバック時は空。
+func (s *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	ids := make([]string, 0, len(s.keys))
+	for kid := range s.keys {
+		ids = append(ids, kid)
+	}
+	sort.Strings(ids)
+
+	for _, kid := range ids {
+		key := s.keys[kid]
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "OKP",
+				Kid: kid,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return jwks
+}
@@ -0,0 +1,133 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer はメール送信の実装を差し替えるためのインターフェース。
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// ErrNoMailer は MAIL_DRIVER が未設定か、未対応の値の場合に返す。
+var ErrNoMailer = errors.New("MAIL_DRIVER must be smtp or outbox")
+
+var current atomic.Pointer[Mailer]
+
+// Init は環境変数から Mailer を作る。メールを送れない状態で起動しないよう、起動時に呼ぶ。
+func Init() error {
+	m, err := NewMailer()
+	if err != nil {
+		return err
+	}
+	current.Store(&m)
+	return nil
+}
+
+// Current は Init で作った Mailer を返す。未初期化の場合は環境変数から作る。
+func Current() Mailer {
+	if m := current.Load(); m != nil {
+		return *m
+	}
+	m, err := NewMailer()
+	if err != nil {
+		panic(err)
+	}
+	current.CompareAndSwap(nil, &m)
+	return *current.Load()
+}
+
+// NewMailer は MAIL_DRIVER の値に応じて Mailer を返す。
+// smtp は SMTP サーバーへ送信し、outbox は送信せずに MAIL_OUTBOX_DIR へ書き出す（ローカル開発用）。
+// 未設定の場合は送信先が無いままトークンを発行しないようエラーにする。
+func NewMailer() (Mailer, error) {
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "smtp":
+		m := &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+		if m.Host == "" || m.Port == "" || m.From == "" {
+			return nil, errors.New("SMTP_HOST, SMTP_PORT and MAIL_FROM are required when MAIL_DRIVER=smtp")
+		}
+		return m, nil
+	case "outbox":
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if dir == "" {
+			return nil, errors.New("MAIL_OUTBOX_DIR is required when MAIL_DRIVER=outbox")
+		}
+		return &OutboxMailer{Dir: dir}, nil
+	case "":
+		return nil, ErrNoMailer
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrNoMailer, driver)
+	}
+}
+
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{msg.To}, buildMessage(m.From, msg))
+}
+
+// OutboxMailer は送信の代わりにメールを Dir 配下へ .eml ファイルとして保存する。ローカル開発とテスト用。
+// 本文にはトークン付きの URL が含まれるため、標準出力やログには書き出さない。
+type OutboxMailer struct {
+	Dir string
+}
+
+func (m *OutboxMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), sanitizeFileName(msg.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), buildMessage("noreply@localhost", msg), 0o600)
+}
+
+func buildMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", msg.Subject) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
+
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,285 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "cbm-api"
+	testClientSecret = "secret"
+	testRedirectURL  = "http://localhost:3000/oidc/callback"
+	testKeyID        = "test-key"
+)
+
+// mockIssuer はディスカバリー・JWKS・トークンエンドポイントを持つテスト用の OpenID プロバイダー。
+// authorize で発行した認可コードは、PKCE のチャレンジに合うコード検証子と一緒の場合だけ交換できる。
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+	// claims は発行する ID トークンのクレームを書き換える。テストごとに設定する
+	claims func(claims jwt.MapClaims)
+}
+
+type authorization struct {
+	challenge string
+	nonce     string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := &mockIssuer{key: key, codes: make(map[string]authorization)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.serveDiscovery)
+	mux.HandleFunc("/jwks", issuer.serveJWKS)
+	mux.HandleFunc("/token", issuer.serveToken)
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func (m *mockIssuer) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(discovery{
+		Issuer:                m.URL,
+		AuthorizationEndpoint: m.URL + "/authorize",
+		TokenEndpoint:         m.URL + "/token",
+		JWKSURI:               m.URL + "/jwks",
+	})
+}
+
+func (m *mockIssuer) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string][]jwk{"keys": {{
+		Kty: "RSA",
+		Kid: testKeyID,
+		N:   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+	}}})
+}
+
+func (m *mockIssuer) serveToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, _ := r.BasicAuth()
+	if clientID != testClientID || clientSecret != testClientSecret {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != testRedirectURL {
+		tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	m.mu.Lock()
+	auth, ok := m.codes[r.PostFormValue("code")]
+	delete(m.codes, r.PostFormValue("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": m.signIDToken(auth.nonce)})
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+func (m *mockIssuer) signIDToken(nonce string) string {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            m.URL,
+		"aud":            testClientID,
+		"sub":            "user-1",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"name":           "テストユーザー",
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+	if m.claims != nil {
+		m.claims(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// authorize は利用者が認可エンドポイントで同意した場合と同じく、認可 URL の内容から認可コードを発行する。
+func (m *mockIssuer) authorize(t *testing.T, authorizationURL string) string {
+	t.Helper()
+	u, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if u.Path != "/authorize" || query.Get("client_id") != testClientID || query.Get("redirect_uri") != testRedirectURL {
+		t.Fatalf("unexpected authorization URL: %s", authorizationURL)
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("PKCE parameters are missing: %s", authorizationURL)
+	}
+
+	code, err := RandomString(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.codes[code] = authorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	m.mu.Unlock()
+	return code
+}
+
+func (m *mockIssuer) provider() *Provider {
+	return &Provider{
+		Issuer:       m.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+		HTTPClient:   m.Client(),
+	}
+}
+
+// startLogin は OIDCLogin と同じ手順で認可 URL を作り、認可コードを受け取る。
+func startLogin(t *testing.T, issuer *mockIssuer, provider *Provider) (code, verifier, nonce string) {
+	t.Helper()
+	nonce, err := RandomString(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, challenge, err := PKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizationURL, err := provider.AuthCodeURL(context.Background(), "state", nonce, challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	return issuer.authorize(t, authorizationURL), verifier, nonce
+}
+
+func TestExchange(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	code, verifier, nonce := startLogin(t, issuer, provider)
+
+	claims, err := provider.Exchange(context.Background(), code, verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := Claims{Subject: "user-1", Email: "user@example.com", EmailVerified: true, Name: "テストユーザー"}
+	if *claims != want {
+		t.Errorf("got %+v, want %+v", *claims, want)
+	}
+
+	// 認可コードは一度しか使えない
+	if _, err := provider.Exchange(context.Background(), code, verifier, nonce); err == nil {
+		t.Error("使用済みの認可コードで交換できました")
+	}
+}
+
+func TestExchangeRequiresMatchingCodeVerifier(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	code, _, nonce := startLogin(t, issuer, provider)
+
+	otherVerifier, _, err := PKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Exchange(context.Background(), code, otherVerifier, nonce); err == nil {
+		t.Error("別のコード検証子で交換できました")
+	}
+}
+
+func TestExchangeRejectsInvalidIDToken(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		claims func(claims jwt.MapClaims)
+		nonce  string
+	}{
+		{"nonce mismatch", nil, "other-nonce"},
+		{"missing nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, ""},
+		{"issuer mismatch", func(c jwt.MapClaims) { c["iss"] = "https://attacker.example.com" }, ""},
+		{"audience mismatch", func(c jwt.MapClaims) { c["aud"] = "other-client" }, ""},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, ""},
+		{"missing exp", func(c jwt.MapClaims) { delete(c, "exp") }, ""},
+		{"missing subject", func(c jwt.MapClaims) { delete(c, "sub") }, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := newMockIssuer(t)
+			issuer.claims = tt.claims
+			provider := issuer.provider()
+			code, verifier, nonce := startLogin(t, issuer, provider)
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			if _, err := provider.Exchange(context.Background(), code, verifier, nonce); err != ErrInvalidIDToken {
+				t.Errorf("got %v, want %v", err, ErrInvalidIDToken)
+			}
+		})
+	}
+
+	t.Run("signed by another key", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		provider := issuer.provider()
+		if _, err := provider.getDiscovery(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		issuer.key, otherKey = otherKey, issuer.key
+		rawIDToken := issuer.signIDToken("nonce")
+		issuer.key, otherKey = otherKey, issuer.key
+
+		if _, err := provider.VerifyIDToken(context.Background(), rawIDToken, "nonce"); err != ErrInvalidIDToken {
+			t.Errorf("got %v, want %v", err, ErrInvalidIDToken)
+		}
+	})
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	provider.Issuer = strings.Replace(issuer.URL, "127.0.0.1", "localhost", 1)
+
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err == nil {
+		t.Error("ディスカバリーの issuer が異なるプロバイダーを受け入れました")
+	}
+}
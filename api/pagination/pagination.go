@@ -0,0 +1,252 @@
+package pagination
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPerPage = 50
+	MaxPerPage     = 100
+)
+
+var ErrInvalidCursor = errors.New("pagination: invalid cursor")
+
+// Cursor は次のページの位置。クライアントには Encode した文字列（nextCursor）だけを渡す。
+type Cursor struct {
+	// Value と ID はキーセット方式で使う、直前のページの最後の行の並び替え列の値と主キー。
+	// 主キー順で並べる場合 Value は空
+	Value  string `json:"v,omitempty"`
+	ID     uint   `json:"id,omitempty"`
+	// Offset は関連度順など列の値で位置を表せない並び順で使う
+	Offset int    `json:"o,omitempty"`
+	// Order はカーソルを作った一覧の OrderKey。並び順や絞り込み条件の違う一覧でカーソルを使えないようにする
+	Order  string `json:"s"`
+}
+
+// OrderKey は一覧の種類と並び順、絞り込み条件からカーソルに埋め込む値を作る。
+// 検索語などをそのままカーソルに含めないようハッシュにする。
+func OrderKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Offset < 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// Params はリクエストで指定されたページ。
+// cursor を指定した場合はカーソル方式、それ以外は page / perPage によるページ番号方式になる。
+type Params struct {
+	Page    int
+	PerPage int
+	Cursor  *Cursor
+	// WithTotal が true の場合は総件数を数える。ページ番号方式では常に true、
+	// カーソル方式では total=true を指定した場合だけ true
+	WithTotal bool
+}
+
+// Parse はクエリパラメータ page / perPage / cursor / total を読み取る。
+// page と perPage の不正な値は既定値として扱い、perPage は MaxPerPage までに切り詰める。
+func Parse(c *gin.Context) (Params, error) {
+	params := Params{Page: 1, PerPage: DefaultPerPage}
+
+	if pageStr := c.Query("page"); pageStr != "" {
+		if parsedPage, err := strconv.Atoi(pageStr); err == nil && parsedPage > 0 {
+			params.Page = parsedPage
+		}
+	}
+
+	if perPageStr := c.Query("perPage"); perPageStr != "" {
+		if parsedPerPage, err := strconv.Atoi(perPageStr); err == nil && parsedPerPage > 0 {
+			params.PerPage = min(parsedPerPage, MaxPerPage)
+		}
+	}
+
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		cursor, err := DecodeCursor(cursorStr)
+		if err != nil {
+			return params, err
+		}
+		params.Cursor = cursor
+		params.Page = 0
+	}
+
+	params.WithTotal = params.Cursor == nil || c.Query("total") == "true"
+	return params, nil
+}
+
+// Check はカーソルが order の一覧で作られたもので、keyset が true ならキーセット方式、
+// false ならオフセット方式のカーソルであることを確かめる。違う場合は ErrInvalidCursor を返す。
+func (p Params) Check(order string, keyset bool) error {
+	if p.Cursor == nil {
+		return nil
+	}
+	valid := p.Cursor.Offset == 0 && p.Cursor.ID != 0
+	if !keyset {
+		valid = p.Cursor.Offset > 0 && p.Cursor.ID == 0 && p.Cursor.Value == ""
+	}
+	if !valid || p.Cursor.Order != order {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// Limit は LIMIT と、ページ番号方式またはオフセットのカーソルの OFFSET を設定する。
+// 次のページがあるかを調べるため PerPage より1件多く取得する。
+func (p Params) Limit(db *gorm.DB) *gorm.DB {
+	db = db.Limit(p.PerPage + 1)
+	switch {
+	case p.Cursor == nil:
+		return db.Offset((p.Page - 1) * p.PerPage)
+	case p.Cursor.Offset > 0:
+		return db.Offset(p.Cursor.Offset)
+	}
+	return db
+}
+
+// Offset は今回のページの先頭の位置。オフセットのカーソルを作るのに使う。
+func (p Params) Offset() int {
+	if p.Cursor == nil {
+		return (p.Page - 1) * p.PerPage
+	}
+	return p.Cursor.Offset
+}
+
+// Keyset はキーセットのカーソルの位置より後の行に絞り込む。
+// column と idColumn は呼び出し側で決めた列名で、利用者の入力を渡してはいけない。
+// ORDER BY は column, idColumn の順で、どちらも desc と同じ向きにすること。
+func (p Params) Keyset(db *gorm.DB, column string, value interface{}, idColumn string, desc bool) *gorm.DB {
+	if p.Cursor == nil || p.Cursor.Offset > 0 || p.Cursor.ID == 0 {
+		return db
+	}
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	if column == "" {
+		return db.Where(fmt.Sprintf("%s %s ?", idColumn, op), p.Cursor.ID)
+	}
+	return db.Where(fmt.Sprintf("(%s, %s) %s (?, ?)", column, idColumn, op), value, p.Cursor.ID)
+}
+
+// Trim は Limit で取得した結果を1ページ分に切り詰め、次のページがあるかを返す。
+func Trim[T any](items []T, perPage int) ([]T, bool) {
+	if len(items) > perPage {
+		return items[:perPage], true
+	}
+	return items, false
+}
+
+// Result は1ページ分を取得した結果。
+type Result struct {
+	// Total は Params.WithTotal が true の場合だけ設定する
+	Total *int64
+	// Next は次のページがない場合 nil
+	Next  *Cursor
+}
+
+// Page はレスポンスに含めるページ情報。一覧のレスポンスに埋め込む。
+type Page struct {
+	CurrentPage int    `json:"currentPage,omitempty"`
+	LastPage    int    `json:"lastPage,omitempty"`
+	PerPage     int    `json:"perPage"`
+	Total       *int64 `json:"total,omitempty"`
+	NextCursor  string `json:"nextCursor,omitempty"`
+}
+
+// NewPage はページ情報を作り、RFC 8288 の Link ヘッダー（first / prev / next / last）を設定する。
+// リンクはリクエストのパスとクエリを基にした相対 URL。
+func NewPage(c *gin.Context, params Params, result Result) Page {
+	page := Page{PerPage: params.PerPage, Total: result.Total}
+	if result.Next != nil {
+		page.NextCursor = result.Next.Encode()
+	}
+
+	links := []string{}
+	link := func(rel string, set map[string]string) {
+		query := c.Request.URL.Query()
+		query.Del("page")
+		query.Del("cursor")
+		query.Set("perPage", strconv.Itoa(params.PerPage))
+		for key, value := range set {
+			query.Set(key, value)
+		}
+		links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, c.Request.URL.Path, query.Encode(), rel))
+	}
+
+	if params.Cursor == nil {
+		page.CurrentPage = params.Page
+		page.LastPage = 1
+		if result.Total != nil && *result.Total > 0 {
+			page.LastPage = int((*result.Total + int64(params.PerPage) - 1) / int64(params.PerPage))
+		}
+
+		link("first", map[string]string{"page": "1"})
+		if params.Page > 1 {
+			link("prev", map[string]string{"page": strconv.Itoa(min(params.Page-1, page.LastPage))})
+		}
+		if result.Next != nil {
+			link("next", map[string]string{"page": strconv.Itoa(params.Page + 1)})
+		}
+		link("last", map[string]string{"page": strconv.Itoa(page.LastPage)})
+	} else {
+		link("first", nil)
+		if result.Next != nil {
+			link("next", map[string]string{"cursor": page.NextCursor})
+		}
+	}
+
+	c.Header("Link", strings.Join(links, ", "))
+	return page
+}
+
+// ByID は db の条件に合う行を主キー順のキーセット方式で1ページ分取得する。
+// order は一覧の OrderKey、id は行の主キーを返す関数。
+func ByID[T any](db *gorm.DB, params Params, order string, idColumn string, id func(T) uint) ([]T, Result, error) {
+	var items []T
+	var result Result
+	if err := params.Check(order, true); err != nil {
+		return nil, result, err
+	}
+	db = db.Session(&gorm.Session{})
+
+	if params.WithTotal {
+		var total int64
+		if err := db.Count(&total).Error; err != nil {
+			return nil, result, err
+		}
+		result.Total = &total
+	}
+
+	db = params.Keyset(db.Order(idColumn), "", nil, idColumn, false)
+	if err := params.Limit(db).Find(&items).Error; err != nil {
+		return nil, result, err
+	}
+
+	items, hasNext := Trim(items, params.PerPage)
+	if hasNext {
+		result.Next = &Cursor{ID: id(items[len(items)-1]), Order: order}
+	}
+	return items, result, nil
+}
@@ -0,0 +1,57 @@
+package pagination
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	order := OrderKey("books", "title", "false", "")
+	tests := []struct {
+		name   string
+		cursor *Cursor
+		keyset bool
+		valid  bool
+	}{
+		{"no cursor", nil, true, true},
+		{"keyset", &Cursor{Value: "a", ID: 10, Order: order}, true, true},
+		{"offset", &Cursor{Offset: 50, Order: order}, false, true},
+		{"offset cursor for keyset", &Cursor{Offset: 50, Order: order}, true, false},
+		{"keyset cursor for offset", &Cursor{Value: "a", ID: 10, Order: order}, false, false},
+		{"keyset without id", &Cursor{Value: "a", Order: order}, true, false},
+		{"other sort", &Cursor{Value: "a", ID: 10, Order: OrderKey("books", "createdAt", "false", "")}, true, false},
+		{"other query", &Cursor{Offset: 50, Order: OrderKey("books", "title", "false", "go")}, false, false},
+		{"no order", &Cursor{ID: 10}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := Params{PerPage: DefaultPerPage, Cursor: tt.cursor}
+			err := params.Check(order, tt.keyset)
+			if tt.valid && err != nil {
+				t.Errorf("got %v, want nil", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("got %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := Cursor{Value: "2024-04-01T09:00:00Z", ID: 42, Order: OrderKey("books", "createdAt", "true", "")}
+
+	decoded, err := DecodeCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("DecodeCursor: %v", err)
+	}
+	if *decoded != cursor {
+		t.Errorf("got %+v, want %+v", *decoded, cursor)
+	}
+}
+
+func TestOrderKeySeparatesParts(t *testing.T) {
+	if OrderKey("books", "ab", "c") == OrderKey("books", "a", "bc") {
+		t.Error("区切りの違う条件が同じ値になっています")
+	}
+}
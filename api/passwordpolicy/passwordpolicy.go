@@ -0,0 +1,221 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// ルールごとのエラーコード。API のレスポンスにそのまま返す。
+const (
+	CodeTooShort = "too_short"
+	CodeTooLong  = "too_long"
+	CodeBanned   = "banned"
+	CodeBreached = "breached"
+)
+
+// bcrypt は 72 バイトを超える入力を扱えないため、最大長の上限にする
+const bcryptMaxBytes = 72
+
+// Violation は満たしていないルール1つ分。
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Policy は登録・パスワード変更・再設定で共通に使うパスワードの要件。
+type Policy struct {
+	// MinLength は文字数、MaxLength はバイト数で数える
+	MinLength int
+	MaxLength int
+	// Banned はよく使われるパスワードの一覧（小文字）
+	Banned map[string]struct{}
+	// BreachedDir は漏洩パスワードの SHA-1 ハッシュを k-匿名性の形式で保存したディレクトリ。
+	// Have I Been Pwned の range API と同じく、ハッシュ先頭5文字のファイルに「残り35文字:件数」を1行ずつ持つ。
+	BreachedDir string
+	// BreachedMinCount 件以上漏洩しているパスワードを拒否する
+	BreachedMinCount int
+}
+
+var current atomic.Pointer[Policy]
+
+// Init は環境変数からポリシーを読み込む。
+func Init() error {
+	policy, err := LoadFromEnv()
+	if err != nil {
+		return err
+	}
+	current.Store(policy)
+	return nil
+}
+
+// Current は Init で読み込んだポリシーを返す。未初期化の場合は環境変数から読み込む。
+func Current() *Policy {
+	if policy := current.Load(); policy != nil {
+		return policy
+	}
+	policy, err := LoadFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	current.CompareAndSwap(nil, policy)
+	return current.Load()
+}
+
+// LoadFromEnv は次の環境変数からポリシーを作る。
+//
+//	PASSWORD_MIN_LENGTH            最小文字数（既定 8）
+//	PASSWORD_MAX_LENGTH            最大バイト数（既定・上限 72）
+//	PASSWORD_BANNED_LIST           禁止パスワードの一覧ファイル（1行1件、# 以降はコメント）
+//	PASSWORD_BREACHED_DIR          漏洩パスワードのハッシュを置いたディレクトリ
+//	PASSWORD_BREACHED_MIN_COUNT    拒否する漏洩件数の下限（既定 1）
+func LoadFromEnv() (*Policy, error) {
+	policy := &Policy{
+		MinLength:        8,
+		MaxLength:        bcryptMaxBytes,
+		Banned:           map[string]struct{}{},
+		BreachedDir:      os.Getenv("PASSWORD_BREACHED_DIR"),
+		BreachedMinCount: 1,
+	}
+
+	if err := envInt("PASSWORD_MIN_LENGTH", &policy.MinLength); err != nil {
+		return nil, err
+	}
+	if err := envInt("PASSWORD_MAX_LENGTH", &policy.MaxLength); err != nil {
+		return nil, err
+	}
+	if err := envInt("PASSWORD_BREACHED_MIN_COUNT", &policy.BreachedMinCount); err != nil {
+		return nil, err
+	}
+	if policy.MaxLength <= 0 || policy.MaxLength > bcryptMaxBytes {
+		policy.MaxLength = bcryptMaxBytes
+	}
+
+	if path := os.Getenv("PASSWORD_BANNED_LIST"); path != "" {
+		banned, err := LoadBannedList(path)
+		if err != nil {
+			return nil, err
+		}
+		policy.Banned = banned
+	}
+	return policy, nil
+}
+
+// LoadBannedList は1行1件の禁止パスワード一覧を読み込む。空行と # で始まる行は無視する。
+func LoadBannedList(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	banned := map[string]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		banned[strings.ToLower(line)] = struct{}{}
+	}
+	return banned, scanner.Err()
+}
+
+// Validate は満たしていないルールを全て返す。全て満たしている場合は空のスライスを返す。
+// エラーは漏洩パスワードのデータを読めなかった場合のみ返す。
+func (p *Policy) Validate(password string) ([]Violation, error) {
+	violations := []Violation{}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("パスワードは%d文字以上にしてください", p.MinLength),
+		})
+	}
+	if len(password) > p.MaxLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("パスワードは%dバイト以内にしてください", p.MaxLength),
+		})
+	}
+	if _, ok := p.Banned[strings.ToLower(password)]; ok {
+		violations = append(violations, Violation{
+			Code:    CodeBanned,
+			Message: "よく使われているパスワードのため使用できません",
+		})
+	}
+
+	breached, err := p.isBreached(password)
+	if err != nil {
+		return nil, err
+	}
+	if breached {
+		violations = append(violations, Violation{
+			Code:    CodeBreached,
+			Message: "過去に漏洩したことのあるパスワードのため使用できません",
+		})
+	}
+
+	return violations, nil
+}
+
+// isBreached はパスワードの SHA-1 ハッシュの先頭5文字のファイルだけを読み、残りの35文字を探す。
+// 該当するファイルがない場合は漏洩していないものとして扱う。
+func (p *Policy) isBreached(password string) (bool, error) {
+	if p.BreachedDir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(p.BreachedDir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(p.BreachedDir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		candidate, countText, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+		count := 1
+		if countText != "" {
+			if parsed, err := strconv.Atoi(countText); err == nil {
+				count = parsed
+			}
+		}
+		return count >= p.BreachedMinCount, nil
+	}
+	return false, scanner.Err()
+}
+
+func envInt(name string, value *int) error {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*value = parsed
+	return nil
+}
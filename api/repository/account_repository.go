@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+)
+
+// BookDisposition は退会するユーザーが所有する本の扱い。
+type BookDisposition string
+
+const (
+	BookDispositionTransfer BookDisposition = "transfer"
+	BookDispositionDelete   BookDisposition = "delete"
+)
+
+// 退会後のユーザー行に残す表示名
+const DeletedUserName = "退会済みユーザー"
+
+var (
+	ErrAccountHasActiveLoans     = errors.New("account has unreturned loans")
+	ErrOwnedBooksOnLoan          = errors.New("owned books are on loan")
+	ErrBookDispositionRequired   = errors.New("book disposition is required")
+	ErrBookTransferTargetInvalid = errors.New("book transfer target is invalid")
+)
+
+type AccountRepository struct{}
+
+func NewAccountRepository() *AccountRepository {
+	return &AccountRepository{}
+}
+
+// DeleteAccount はユーザーを退会させる。
+//
+// 未返却の本がある場合は ErrAccountHasActiveLoans を返す。所有する本は disposition に従って
+// transferTo のユーザーへ移すか削除する。お気に入り・トークン・セッションなどは物理削除する。
+// 統計用に残す貸出履歴（返却済みの BorrowedBook）はユーザー行を参照したままにし、
+// 参照先のユーザー行から名前とメールアドレスを消して論理削除する。監査ログは ID だけを残す。
+func (r *AccountRepository) DeleteAccount(userID uint, disposition BookDisposition, transferTo uint) error {
+	tx := database.Db.Begin()
+
+	var user schema.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var activeLoans int64
+	if err := tx.Model(&schema.BorrowedBook{}).Where("user_id = ?", userID).Count(&activeLoans).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if activeLoans > 0 {
+		tx.Rollback()
+		return ErrAccountHasActiveLoans
+	}
+
+	if err := disposeOwnedBooks(tx, userID, disposition, transferTo); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := deletePersonalRecords(tx, &user); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Model(&user).Updates(map[string]interface{}{
+		"name":          DeletedUserName,
+		"email":         fmt.Sprintf("deleted-%d@deleted.invalid", user.ID),
+		"password":      "",
+		"pending_email": "",
+		"verified_at":   nil,
+		"role":          schema.UserRole,
+	}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Delete(&user).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func disposeOwnedBooks(tx *gorm.DB, userID uint, disposition BookDisposition, transferTo uint) error {
+	var bookIDs []uint
+	if err := tx.Model(&schema.Book{}).Where("user_id = ?", userID).Pluck("id", &bookIDs).Error; err != nil {
+		return err
+	}
+	if len(bookIDs) == 0 {
+		return nil
+	}
+
+	switch disposition {
+	case BookDispositionTransfer:
+		if transferTo == 0 || transferTo == userID {
+			return ErrBookTransferTargetInvalid
+		}
+		var target schema.User
+		if err := tx.Select("id").First(&target, transferTo).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrBookTransferTargetInvalid
+			}
+			return err
+		}
+		return tx.Model(&schema.Book{}).Where("id IN ?", bookIDs).Update("user_id", transferTo).Error
+
+	case BookDispositionDelete:
+		// 他のユーザーに貸し出し中の本は返却されるまで削除できない
+		var onLoan int64
+		if err := tx.Model(&schema.BorrowedBook{}).Where("book_id IN ?", bookIDs).Count(&onLoan).Error; err != nil {
+			return err
+		}
+		if onLoan > 0 {
+			return ErrOwnedBooksOnLoan
+		}
+		if err := tx.Unscoped().Where("book_id IN ?", bookIDs).Delete(&schema.BorrowingWishList{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", bookIDs).Delete(&schema.Book{}).Error
+
+	default:
+		return ErrBookDispositionRequired
+	}
+}
+
+// deletePersonalRecords はユーザーに紐づく個人データを物理削除する。
+// 監査ログは削除できないため、ユーザー本人の操作（操作者が不明でユーザーが対象のものを含む）の IP アドレスと User-Agent を消す。
+func deletePersonalRecords(tx *gorm.DB, user *schema.User) error {
+	if err := tx.Model(&schema.AuditEvent{}).
+		Where("actor_id = ? OR (actor_id IS NULL AND target_type = ? AND target_id = ?)", user.ID, AuditTargetUser, user.ID).
+		Where("ip <> '' OR user_agent <> ''").
+		Updates(map[string]interface{}{"ip": "", "user_agent": ""}).Error; err != nil {
+		return err
+	}
+
+	models := []interface{}{
+		&schema.BorrowingWishList{},
+		&schema.RefreshToken{},
+		&schema.Session{},
+		&schema.PasswordResetToken{},
+		&schema.APIKey{},
+		&schema.TwoFactor{},
+		&schema.RecoveryCode{},
+		&schema.UserIdentity{},
+	}
+	for _, model := range models {
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Unscoped().Where("key = ?", AccountAttemptKey(user.Email)).Delete(&schema.LoginAttempt{}).Error
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestDeletePersonalRecordsRedactsAuditEvents(t *testing.T) {
+	db, recorder := newDryRunDB(t)
+	user := &schema.User{Model: gorm.Model{ID: 42}, Email: "user@example.com"}
+
+	if err := deletePersonalRecords(db, user); err != nil {
+		t.Fatalf("deletePersonalRecords: %v", err)
+	}
+	if !recorder.contains(`UPDATE "audit_events" SET "ip"='',"user_agent"=''`, `actor_id = 42 OR (actor_id IS NULL AND target_type = 'user' AND target_id = 42)`) {
+		t.Errorf("監査ログの IP アドレスと User-Agent を消していません: %q", recorder.statements)
+	}
+	if !recorder.contains(`DELETE FROM "login_attempts"`, "account:user@example.com") {
+		t.Errorf("ログイン試行の記録を削除していません: %q", recorder.statements)
+	}
+}
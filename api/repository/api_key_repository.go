@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix は API キーを JWT と見分けるための接頭辞。
+const APIKeyPrefix = "cbm_"
+
+// 最終利用日時の更新はこの間隔より細かくは行わない
+const apiKeyLastUsedInterval = time.Minute
+
+var ErrAPIKeyInvalid = errors.New("api key is invalid")
+
+type APIKeyRepository struct{}
+
+func NewAPIKeyRepository() *APIKeyRepository {
+	return &APIKeyRepository{}
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// CreateAPIKey は API キーを発行し、平文のキーを返す。平文はこの時にしか取得できない。
+func (r *APIKeyRepository) CreateAPIKey(userID uint, name string, scopes []schema.APIKeyScope, expiresAt *time.Time) (*schema.APIKey, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	scopeNames := make([]string, len(scopes))
+	for i, scope := range scopes {
+		scopeNames[i] = string(scope)
+	}
+
+	apiKey := schema.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:len(APIKeyPrefix)+8],
+		KeyHash:   hashToken(key),
+		Scopes:    strings.Join(scopeNames, ","),
+		ExpiresAt: expiresAt,
+	}
+	if err := database.Db.Create(&apiKey).Error; err != nil {
+		return nil, "", err
+	}
+	return &apiKey, key, nil
+}
+
+func (r *APIKeyRepository) GetAPIKeysByUserID(userID uint) ([]schema.APIKey, error) {
+	var apiKeys []schema.APIKey
+	err := database.Db.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at DESC").Find(&apiKeys).Error
+	return apiKeys, err
+}
+
+// RevokeAPIKey は利用者自身の API キーを失効させる。該当するキーがない場合は ErrAPIKeyInvalid。
+func (r *APIKeyRepository) RevokeAPIKey(userID, apiKeyID uint) error {
+	result := database.Db.Model(&schema.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", apiKeyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyInvalid
+	}
+	return nil
+}
+
+// RevokeUserAPIKeys はユーザーの有効な API キーを全て失効させる。
+// パスワードの変更など、認証情報を入れ替える処理と同じトランザクションで呼ぶ。
+func RevokeUserAPIKeys(tx *gorm.DB, userID uint) error {
+	return tx.Model(&schema.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Authenticate は平文の API キーを検証し、キーと所有ユーザーを返す。
+// 検証に成功した場合は最終利用日時を更新する。
+func (r *APIKeyRepository) Authenticate(key string) (*schema.APIKey, *schema.User, error) {
+	var apiKey schema.APIKey
+	if err := database.Db.Where("key_hash = ? AND revoked_at IS NULL", hashToken(key)).First(&apiKey).Error; err != nil {
+		return nil, nil, ErrAPIKeyInvalid
+	}
+
+	now := time.Now()
+	if apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt) {
+		return nil, nil, ErrAPIKeyInvalid
+	}
+
+	var user schema.User
+	if err := database.Db.First(&user, apiKey.UserID).Error; err != nil {
+		return nil, nil, ErrAPIKeyInvalid
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyLastUsedInterval {
+		database.Db.Model(&apiKey).Update("last_used_at", now)
+	}
+
+	return &apiKey, &user, nil
+}
+
+// ParseAPIKeyScopes はカンマ区切りのスコープを検証して返す。
+func ParseAPIKeyScopes(scopes string) []schema.APIKeyScope {
+	var result []schema.APIKeyScope
+	for _, name := range strings.Split(scopes, ",") {
+		for _, scope := range schema.APIKeyScopes {
+			if string(scope) == name {
+				result = append(result, scope)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"encoding/json"
+	"github.com/sayasurvey/golang/api/pagination"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 監査ログの操作名
+const (
+	AuditUserRegistered         = "user.registered"
+	AuditLoginSucceeded         = "auth.login.succeeded"
+	AuditLoginFailed            = "auth.login.failed"
+	AuditLoginLocked            = "auth.login.locked"
+	AuditLogout                 = "auth.logout"
+	AuditRefreshTokenReused     = "auth.refresh_token.reused"
+	AuditPasswordChanged        = "password.changed"
+	AuditPasswordResetRequested = "password.reset_requested"
+	AuditPasswordReset          = "password.reset"
+	AuditEmailChangeRequested   = "email.change_requested"
+	AuditEmailVerified          = "email.verified"
+	AuditTwoFactorEnabled       = "two_factor.enabled"
+	AuditTwoFactorDisabled      = "two_factor.disabled"
+	AuditRecoveryCodesRenewed   = "two_factor.recovery_codes_regenerated"
+	AuditAPIKeyCreated          = "api_key.created"
+	AuditAPIKeyRevoked          = "api_key.revoked"
+	AuditSessionRevoked         = "session.revoked"
+	AuditBookDeleted            = "book.deleted"
+	AuditAccountDeleted         = "account.deleted"
+	AuditUserDeleted            = "admin.user.deleted"
+	AuditUserRoleChanged        = "admin.user.role_changed"
+	AuditUserSuspended          = "admin.user.suspended"
+	AuditUserReactivated        = "admin.user.reactivated"
+	AuditUserPasswordReset      = "admin.user.password_reset"
+	AuditUserUnlocked           = "admin.user.unlocked"
+	AuditInviteCreated          = "admin.invite.created"
+	AuditInviteRevoked          = "admin.invite.revoked"
+	AuditSettingUpdated         = "admin.setting.updated"
+	AuditBooksReassigned        = "admin.books.reassigned"
+)
+
+// 監査ログの対象の種類
+const (
+	AuditTargetUser    = "user"
+	AuditTargetAPIKey  = "api_key"
+	AuditTargetSession = "session"
+	AuditTargetInvite  = "invite"
+	AuditTargetSetting = "setting"
+	AuditTargetBook    = "book"
+)
+
+// AuditFilter は監査ログの検索条件。ゼロ値の項目では絞り込まない。
+// Action の末尾を * にすると前方一致になる（例: admin.*）。
+type AuditFilter struct {
+	Action     string
+	ActorID    uint
+	TargetType string
+	TargetID   uint
+	IP         string
+	From       time.Time
+	To         time.Time
+}
+
+type AuditRepository struct{}
+
+func NewAuditRepository() *AuditRepository {
+	return &AuditRepository{}
+}
+
+// Record は監査ログを追記する。metadata は JSON にして保存する。
+func (r *AuditRepository) Record(event schema.AuditEvent, metadata map[string]interface{}) error {
+	event.UserAgent = truncateUserAgent(event.UserAgent)
+	if metadata != nil {
+		encoded, err := json.Marshal(metadata)
+		if err != nil {
+			return err
+		}
+		event.Metadata = string(encoded)
+	} else {
+		event.Metadata = "{}"
+	}
+	return database.Db.Create(&event).Error
+}
+
+// SearchEvents は条件に合う監査ログを新しい順に1ページ分返す。
+// 監査ログは追記専用で主キーの順が変わらないため、次のページは主キーのキーセット方式のカーソルで表す。
+func (r *AuditRepository) SearchEvents(filter AuditFilter, params pagination.Params) ([]schema.AuditEvent, pagination.Result, error) {
+	var events []schema.AuditEvent
+	var result pagination.Result
+	order := filter.orderKey()
+	if err := params.Check(order, true); err != nil {
+		return nil, result, err
+	}
+
+	query := filter.apply(database.Db.Model(&schema.AuditEvent{})).Session(&gorm.Session{})
+
+	if params.WithTotal {
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return nil, result, err
+		}
+		result.Total = &total
+	}
+
+	query = params.Keyset(query.Order("id DESC"), "", nil, "id", true)
+	if err := params.Limit(query).Find(&events).Error; err != nil {
+		return nil, result, err
+	}
+
+	events, hasNext := pagination.Trim(events, params.PerPage)
+	if hasNext {
+		result.Next = &pagination.Cursor{ID: events[len(events)-1].ID, Order: order}
+	}
+	return events, result, nil
+}
+
+// EachEvent は条件に合う監査ログを新しい順に1件ずつ fn に渡す。CSV 出力など全件を扱う場合に使う。
+func (r *AuditRepository) EachEvent(filter AuditFilter, fn func(schema.AuditEvent) error) error {
+	rows, err := filter.apply(database.Db.Model(&schema.AuditEvent{})).Order("id DESC").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event schema.AuditEvent
+		if err := database.Db.ScanRows(rows, &event); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// orderKey は検索条件のカーソルに埋め込む値。
+func (f AuditFilter) orderKey() string {
+	return pagination.OrderKey("audit_events", f.Action, strconv.FormatUint(uint64(f.ActorID), 10), f.TargetType,
+		strconv.FormatUint(uint64(f.TargetID), 10), f.IP, f.From.Format(time.RFC3339Nano), f.To.Format(time.RFC3339Nano))
+}
+
+func (f AuditFilter) apply(query *gorm.DB) *gorm.DB {
+	if prefix, ok := strings.CutSuffix(f.Action, "*"); ok {
+		query = query.Where("action LIKE ?", escapeLike(prefix)+"%")
+	} else if f.Action != "" {
+		query = query.Where("action = ?", f.Action)
+	}
+	if f.ActorID != 0 {
+		query = query.Where("actor_id = ?", f.ActorID)
+	}
+	if f.TargetType != "" {
+		query = query.Where("target_type = ?", f.TargetType)
+	}
+	if f.TargetID != 0 {
+		query = query.Where("target_id = ?", f.TargetID)
+	}
+	if f.IP != "" {
+		query = query.Where("ip = ?", f.IP)
+	}
+	if !f.From.IsZero() {
+		query = query.Where("created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		query = query.Where("created_at < ?", f.To)
+	}
+	return query
+}
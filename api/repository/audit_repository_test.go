@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"errors"
+	"github.com/sayasurvey/golang/api/pagination"
+	"testing"
+)
+
+// 検索条件の違う一覧のカーソルはデータベースに問い合わせる前に拒否する
+func TestSearchEventsRejectsCursorOfOtherFilter(t *testing.T) {
+	logins := AuditFilter{Action: "auth.login"}
+	cursor := &pagination.Cursor{ID: 100, Order: logins.orderKey()}
+
+	params := pagination.Params{PerPage: pagination.DefaultPerPage, Cursor: cursor}
+	if _, _, err := new(AuditRepository).SearchEvents(AuditFilter{Action: "auth.logout"}, params); !errors.Is(err, pagination.ErrInvalidCursor) {
+		t.Errorf("got %v, want %v", err, pagination.ErrInvalidCursor)
+	}
+}
@@ -5,31 +5,53 @@ import (
 	"github.com/sayasurvey/golang/model/database"
 	"golang.org/x/crypto/bcrypt"
 	"github.com/golang-jwt/jwt/v5"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/sayasurvey/golang/api/jwtkey"
 	"time"
-	"os"
 )
 
+// アクセストークンは短命にし、更新はリフレッシュトークンで行う
+const AccessTokenTTL = time.Minute * 15
+
 type AuthRepository struct{}
 
 func NewAuthRepository() *AuthRepository {
 	return &AuthRepository{}
 }
 
-func (r *AuthRepository) CreateUser(name, email, password string) error {
+func (r *AuthRepository) CreateUser(name, email, password string) (*schema.User, error) {
+	user, err := newUser(name, email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.Db.Create(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func newUser(name, email, password string) (*schema.User, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	user := schema.User{
+	return &schema.User{
 		Name:     name,
 		Email:    email,
 		Password: string(hashedPassword),
 		Role:     schema.UserRole,
-	}
+	}, nil
+}
 
-	result := database.Db.Create(&user)
-	return result.Error
+func (r *AuthRepository) FindUserByID(id uint) (*schema.User, error) {
+	var user schema.User
+	if err := database.Db.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
 func (r *AuthRepository) FindUserByEmail(email string) (*schema.User, error) {
@@ -45,19 +67,60 @@ func (r *AuthRepository) ValidatePassword(user *schema.User, password string) er
 	return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 }
 
-func (r *AuthRepository) GenerateToken(user *schema.User) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+// dummyPasswordHash は登録されていないメールアドレスでのログインで比較に使う、bcrypt.DefaultCost のハッシュ
+const dummyPasswordHash = "$2a$10$09tIzdMyYnm51tqwp1jqT.NVCmLkAEVrqVm4UDvjw6Asv8tvd7pMK"
+
+// ValidateDummyPassword はユーザーがいない場合にも ValidatePassword と同じだけ時間をかけ、
+// 応答時間から登録の有無が分からないようにする。結果は常に不一致になる。
+func (r *AuthRepository) ValidateDummyPassword(password string) {
+	bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+}
+
+// GenerateToken はアクセストークンを発行する。sid にはログインごとのセッション ID を入れる。
+func (r *AuthRepository) GenerateToken(user *schema.User, sessionID uint) (string, error) {
+	jti, err := generateTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	return jwtkey.Current().Sign(jwt.MapClaims{
 		"user_id": user.ID,
 		"email":   user.Email,
 		"role":    user.Role,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"jti":     jti,
+		"sid":     sessionID,
+		"exp":     time.Now().Add(AccessTokenTTL).Unix(),
 	})
+}
 
-	return token.SignedString([]byte(os.Getenv("SECRET_KEY")))
+// InvalidateToken はトークン（jti）を失効リストに登録する。
+// expiresAt を過ぎた行は PurgeExpiredTokens で削除される。
+func (r *AuthRepository) InvalidateToken(token string, expiresAt time.Time) error {
+	invalidatedToken := schema.InvalidatedToken{
+		Token:     token,
+		ExpiresAt: expiresAt,
+	}
+	return database.Db.Create(&invalidatedToken).Error
 }
 
-func (r *AuthRepository) GetAllUsers() ([]schema.User, error) {
-	var users []schema.User
-	err := database.Db.Find(&users).Error
-	return users, err
+func (r *AuthRepository) IsTokenInvalidated(token string) (bool, error) {
+	var count int64
+	err := database.Db.Model(&schema.InvalidatedToken{}).Where("token = ?", token).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *AuthRepository) PurgeExpiredTokens() (int64, error) {
+	result := database.Db.Unscoped().Where("expires_at < ?", time.Now()).Delete(&schema.InvalidatedToken{})
+	return result.RowsAffected, result.Error
+}
+
+func generateTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
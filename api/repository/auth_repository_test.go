@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+func TestValidateDummyPasswordUsesDefaultCost(t *testing.T) {
+	cost, err := bcrypt.Cost([]byte(dummyPasswordHash))
+	if err != nil {
+		t.Fatalf("Cost: %v", err)
+	}
+	if cost != bcrypt.DefaultCost {
+		t.Errorf("登録済みユーザーのハッシュと比較にかかる時間が変わります: cost got %d, want %d", cost, bcrypt.DefaultCost)
+	}
+}
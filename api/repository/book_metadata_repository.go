@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sayasurvey/golang/api/bookmeta"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sync"
+	"time"
+)
+
+const (
+	BookMetadataCacheTTL = time.Hour * 24 * 30
+	// 見つからなかった ISBN は出版後に登録されることがあるため短めにする
+	BookMetadataNotFoundCacheTTL = time.Hour * 24
+)
+
+// BookMetadataCacheStore は書誌情報キャッシュの保存先。
+// 本番は DB、テストではメモリ上の実装を使う。
+type BookMetadataCacheStore interface {
+	// Get は isbn13 のキャッシュを返す。有効期限切れのものも返し、ない場合は nil を返す。
+	Get(isbn13 string) (*schema.BookMetadataCache, error)
+	Save(cache *schema.BookMetadataCache) error
+}
+
+type DBBookMetadataCacheStore struct{}
+
+func (s *DBBookMetadataCacheStore) Get(isbn13 string) (*schema.BookMetadataCache, error) {
+	var cache schema.BookMetadataCache
+	err := database.Db.Where("isbn = ?", isbn13).First(&cache).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+func (s *DBBookMetadataCacheStore) Save(cache *schema.BookMetadataCache) error {
+	return database.Db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "isbn"}},
+		DoUpdates: clause.AssignmentColumns([]string{"found", "data", "expires_at", "updated_at"}),
+	}).Create(cache).Error
+}
+
+type MemoryBookMetadataCacheStore struct {
+	mu     sync.Mutex
+	caches map[string]schema.BookMetadataCache
+}
+
+func NewMemoryBookMetadataCacheStore() *MemoryBookMetadataCacheStore {
+	return &MemoryBookMetadataCacheStore{caches: make(map[string]schema.BookMetadataCache)}
+}
+
+func (s *MemoryBookMetadataCacheStore) Get(isbn13 string) (*schema.BookMetadataCache, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cache, ok := s.caches[isbn13]
+	if !ok {
+		return nil, nil
+	}
+	return &cache, nil
+}
+
+func (s *MemoryBookMetadataCacheStore) Save(cache *schema.BookMetadataCache) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.caches[cache.ISBN] = *cache
+	return nil
+}
+
+// CachedMetadataProvider は書誌情報の取得結果をキャッシュする MetadataProvider。
+// 通信エラーなどの失敗はキャッシュしない。
+type CachedMetadataProvider struct {
+	Provider bookmeta.MetadataProvider
+	Store    BookMetadataCacheStore
+	Now      func() time.Time
+}
+
+func NewCachedMetadataProvider(provider bookmeta.MetadataProvider) *CachedMetadataProvider {
+	return &CachedMetadataProvider{Provider: provider, Store: &DBBookMetadataCacheStore{}, Now: time.Now}
+}
+
+func (p *CachedMetadataProvider) Lookup(ctx context.Context, isbn13 string) (*bookmeta.Metadata, error) {
+	cache, err := p.Store.Get(isbn13)
+	if err != nil {
+		fmt.Println("書誌情報キャッシュの取得に失敗しました:", err)
+	}
+	if cache != nil && cache.ExpiresAt.After(p.Now()) {
+		if !cache.Found {
+			return nil, bookmeta.ErrNotFound
+		}
+		var metadata bookmeta.Metadata
+		if err := json.Unmarshal([]byte(cache.Data), &metadata); err == nil {
+			return &metadata, nil
+		}
+	}
+
+	metadata, err := p.Provider.Lookup(ctx, isbn13)
+	switch {
+	case err == nil:
+		p.store(isbn13, metadata, BookMetadataCacheTTL)
+	case errors.Is(err, bookmeta.ErrNotFound):
+		p.store(isbn13, nil, BookMetadataNotFoundCacheTTL)
+	}
+	return metadata, err
+}
+
+func (p *CachedMetadataProvider) store(isbn13 string, metadata *bookmeta.Metadata, ttl time.Duration) {
+	cache := schema.BookMetadataCache{
+		ISBN:      isbn13,
+		Found:     metadata != nil,
+		ExpiresAt: p.Now().Add(ttl),
+	}
+	if metadata != nil {
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			return
+		}
+		cache.Data = string(data)
+	}
+
+	if err := p.Store.Save(&cache); err != nil {
+		fmt.Println("書誌情報キャッシュの保存に失敗しました:", err)
+	}
+}
+
+func PurgeExpiredBookMetadataCache() (int64, error) {
+	result := database.Db.Unscoped().Where("expires_at < ?", time.Now()).Delete(&schema.BookMetadataCache{})
+	return result.RowsAffected, result.Error
+}
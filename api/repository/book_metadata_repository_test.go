@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/sayasurvey/golang/api/bookmeta"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testISBN = "9784101001616"
+
+// stubMetadataProvider は決まった結果を返し、問い合わせ回数を数える
+type stubMetadataProvider struct {
+	metadata *bookmeta.Metadata
+	err      error
+	calls    int
+}
+
+func (p *stubMetadataProvider) Lookup(ctx context.Context, isbn13 string) (*bookmeta.Metadata, error) {
+	p.calls++
+	return p.metadata, p.err
+}
+
+func newTestCachedProvider(provider bookmeta.MetadataProvider) (*CachedMetadataProvider, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)}
+	return &CachedMetadataProvider{
+		Provider: provider,
+		Store:    NewMemoryBookMetadataCacheStore(),
+		Now:      clock.Now,
+	}, clock
+}
+
+func TestCachedMetadataProviderFound(t *testing.T) {
+	want := &bookmeta.Metadata{ISBN: testISBN, Title: "羅生門・鼻", Authors: []string{"芥川 龍之介"}, PageCount: 192}
+	provider := &stubMetadataProvider{metadata: want}
+	cached, clock := newTestCachedProvider(provider)
+
+	for i := 0; i < 2; i++ {
+		got, err := cached.Lookup(context.Background(), testISBN)
+		if err != nil {
+			t.Fatalf("Lookup: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	}
+	if provider.calls != 1 {
+		t.Errorf("provider calls: got %d, want 1", provider.calls)
+	}
+
+	clock.Advance(BookMetadataCacheTTL)
+	if _, err := cached.Lookup(context.Background(), testISBN); err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if provider.calls != 2 {
+		t.Errorf("有効期限切れのキャッシュを使っています: provider calls got %d, want 2", provider.calls)
+	}
+}
+
+func TestCachedMetadataProviderNotFound(t *testing.T) {
+	provider := &stubMetadataProvider{err: bookmeta.ErrNotFound}
+	cached, clock := newTestCachedProvider(provider)
+
+	for i := 0; i < 2; i++ {
+		if _, err := cached.Lookup(context.Background(), testISBN); !errors.Is(err, bookmeta.ErrNotFound) {
+			t.Fatalf("got %v, want %v", err, bookmeta.ErrNotFound)
+		}
+	}
+	if provider.calls != 1 {
+		t.Errorf("provider calls: got %d, want 1", provider.calls)
+	}
+
+	// 見つからなかった結果は短い期間で問い合わせ直す
+	clock.Advance(BookMetadataNotFoundCacheTTL)
+	provider.metadata, provider.err = &bookmeta.Metadata{ISBN: testISBN, Title: "羅生門・鼻"}, nil
+	got, err := cached.Lookup(context.Background(), testISBN)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if got.Title != "羅生門・鼻" || provider.calls != 2 {
+		t.Errorf("got %+v after %d calls", got, provider.calls)
+	}
+}
+
+func TestCachedMetadataProviderDoesNotCacheErrors(t *testing.T) {
+	unavailable := errors.New("service unavailable")
+	provider := &stubMetadataProvider{err: unavailable}
+	cached, _ := newTestCachedProvider(provider)
+
+	for i := 0; i < 2; i++ {
+		if _, err := cached.Lookup(context.Background(), testISBN); !errors.Is(err, unavailable) {
+			t.Fatalf("got %v, want %v", err, unavailable)
+		}
+	}
+	if provider.calls != 2 {
+		t.Errorf("provider calls: got %d, want 2", provider.calls)
+	}
+
+	cache, err := cached.Store.Get(testISBN)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if cache != nil {
+		t.Errorf("失敗した結果をキャッシュしています: %+v", cache)
+	}
+}
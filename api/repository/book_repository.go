@@ -1,21 +1,352 @@
 package repository
 
 import (
+	"github.com/sayasurvey/golang/api/pagination"
+	"github.com/sayasurvey/golang/api/textnorm"
 	"github.com/sayasurvey/golang/model/database"
 	"github.com/sayasurvey/golang/model/schema"
-	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func GetAllBooks() ([]schema.Book, error) {
+// BookSortField は本の一覧の並び替えに使える項目。
+type BookSortField string
+
+const (
+	BookSortTitle      BookSortField = "title"
+	BookSortCreatedAt  BookSortField = "createdAt"
+	// BookSortPopularity は返却済みを含む貸し出し回数
+	BookSortPopularity BookSortField = "popularity"
+)
+
+// bookSortColumns は並び替えに使える項目と ORDER BY に渡す列。ここにない値は SQL に渡さない。
+// 書名は表記ゆれを揃えた search_title で並べる
+var bookSortColumns = map[BookSortField]string{
+	BookSortTitle:      "books.search_title",
+	BookSortCreatedAt:  "books.created_at",
+	BookSortPopularity: "loan_count",
+}
+
+func IsValidBookSortField(field BookSortField) bool {
+	_, ok := bookSortColumns[field]
+	return ok
+}
+
+// BookSearch は本の一覧の検索条件。ゼロ値の項目では絞り込まない。
+type BookSearch struct {
+	// Query は書名・著者名・説明文を対象にした検索語。
+	// 空白で区切った語をすべて含む本を、書名に一致するものを優先して関連度順に返す
+	Query        string
+	Loanable     *bool
+	OwnerID      uint
+	// Tag はタグ名の完全一致で絞り込む
+	Tag          string
+	// CreatedAfter 以降に登録された本に絞り込む
+	CreatedAfter *time.Time
+	// Sort を指定した場合は関連度より優先して並べる。未指定の場合は登録順
+	Sort         BookSortField
+	SortDesc     bool
+}
+
+// orderKey は検索条件のカーソルに埋め込む値。検索語は正規化した terms で比べる。
+func (s BookSearch) orderKey(terms []string) string {
+	loanable := ""
+	if s.Loanable != nil {
+		loanable = strconv.FormatBool(*s.Loanable)
+	}
+	createdAfter := ""
+	if s.CreatedAfter != nil {
+		createdAfter = s.CreatedAfter.Format(time.RFC3339Nano)
+	}
+	return pagination.OrderKey("books", string(s.Sort), strconv.FormatBool(s.SortDesc), strings.Join(terms, " "),
+		loanable, strconv.FormatUint(uint64(s.OwnerID), 10), s.Tag, createdAfter)
+}
+
+// SearchBooks は検索条件に合う本を1ページ分返す。
+// 主キー順・書名順・登録日時順はキーセット方式、関連度順と貸し出し回数順はオフセットのカーソルで次のページを表す。
+func SearchBooks(search BookSearch, params pagination.Params) ([]schema.Book, pagination.Result, error) {
 	var books []schema.Book
-	db := database.Db
+	var page pagination.Result
+	terms := textnorm.Terms(search.Query)
+	keyset := len(terms) == 0 && search.Sort != BookSortPopularity
+	order := search.orderKey(terms)
+	if err := params.Check(order, keyset); err != nil {
+		return nil, page, err
+	}
+	db := database.Db.Model(&schema.Book{})
+
+	if search.Loanable != nil {
+		db = db.Where("books.loanable = ?", *search.Loanable)
+	}
+	if search.OwnerID != 0 {
+		db = db.Where("books.user_id = ?", search.OwnerID)
+	}
+	if search.Tag != "" {
+		db = db.Where("EXISTS (SELECT 1 FROM book_tags JOIN tags ON tags.id = book_tags.tag_id WHERE book_tags.book_id = books.id AND tags.name = ?)", search.Tag)
+	}
+	if search.CreatedAfter != nil {
+		db = db.Where("books.created_at >= ?", *search.CreatedAfter)
+	}
+	for _, term := range terms {
+		db = db.Where("books.search_text LIKE ?", "%"+escapeLike(term)+"%")
+	}
+	db = db.Session(&gorm.Session{})
 
-	result := db.Preload("User").Find(&books)
+	if params.WithTotal {
+		var total int64
+		if err := db.Count(&total).Error; err != nil {
+			return nil, page, err
+		}
+		page.Total = &total
+	}
+
+	columns := []string{"books.*"}
+	vars := []interface{}{}
+	if search.Sort == BookSortPopularity {
+		columns = append(columns, "(SELECT COUNT(*) FROM borrowed_books WHERE borrowed_books.book_id = books.id) AS loan_count")
+	}
+	sortColumn, sorted := bookSortColumns[search.Sort]
+	if sorted {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: sortColumn, Raw: true}, Desc: search.SortDesc})
+	}
+	if len(terms) > 0 {
+		normalized := strings.Join(terms, " ")
+		columns = append(columns, "(CASE WHEN books.search_title LIKE ? THEN 1 ELSE 0 END) + word_similarity(?, books.search_text) AS search_rank")
+		vars = append(vars, "%"+escapeLike(normalized)+"%", normalized)
+		db = db.Order("search_rank DESC")
+	}
+	if len(columns) > 1 {
+		db = db.Select(strings.Join(columns, ", "), vars...)
+	}
+	db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: "books.id", Raw: true}, Desc: sorted && search.SortDesc})
+
+	if keyset && params.Cursor != nil {
+		var value interface{}
+		switch search.Sort {
+		case BookSortTitle:
+			value = params.Cursor.Value
+		case BookSortCreatedAt:
+			createdAt, err := time.Parse(time.RFC3339Nano, params.Cursor.Value)
+			if err != nil {
+				return nil, page, pagination.ErrInvalidCursor
+			}
+			value = createdAt
+		default:
+			sortColumn = ""
+		}
+		db = params.Keyset(db, sortColumn, value, "books.id", search.SortDesc)
+	}
+
+	result := params.Limit(db).Preload("User").Scopes(WithAuthors, WithTags).Find(&books)
 	if result.Error != nil {
-		fmt.Println("エラー発生:", result.Error)
-		return nil, result.Error
+		return nil, page, result.Error
+	}
+
+	books, hasNext := pagination.Trim(books, params.PerPage)
+	if hasNext {
+		if keyset {
+			last := books[len(books)-1]
+			page.Next = &pagination.Cursor{ID: last.ID, Order: order}
+			switch search.Sort {
+			case BookSortTitle:
+				page.Next.Value = last.SearchTitle
+			case BookSortCreatedAt:
+				page.Next.Value = last.CreatedAt.Format(time.RFC3339Nano)
+			}
+		} else {
+			page.Next = &pagination.Cursor{Offset: params.Offset() + len(books), Order: order}
+		}
+	}
+
+	return books, page, nil
+}
+
+func FindBookOwnerID(bookID uint) (uint, error) {
+	var book schema.Book
+	if err := database.Db.Select("id", "user_id").First(&book, bookID).Error; err != nil {
+		return 0, err
+	}
+	return book.UserId, nil
+}
+
+// ReassignBookOwners は bookID → userID の対応に従って本の所有者をまとめて変更する。
+// 本またはユーザーが存在しない場合は gorm.ErrRecordNotFound を返し、何も変更しない。
+func ReassignBookOwners(owners map[uint]uint) error {
+	tx := database.Db.Begin()
+
+	for bookID, userID := range owners {
+		var user schema.User
+		if err := tx.Select("id").First(&user, userID).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		result := tx.Model(&schema.Book{}).Where("id = ?", bookID).Update("user_id", userID)
+		if result.Error != nil {
+			tx.Rollback()
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			tx.Rollback()
+			return gorm.ErrRecordNotFound
+		}
 	}
 
-	fmt.Printf("取得したユーザー数: %d\n", result.RowsAffected)
-	return books, nil
+	return tx.Commit().Error
+}
+
+// SaveBook は本を作成または更新し、著者を authorNames の順に、タグを tagNames に付け替える。
+// 著者とタグは名前で検索し、存在しない場合は作成する（findOrCreateAuthor、findOrCreateTag）。
+func SaveBook(book *schema.Book, authorNames, tagNames []string) error {
+	setSearchText(book, authorNames)
+
+	tx := database.Db.Begin()
+
+	if err := tx.Omit("User", "BookAuthors", "BookTags").Save(book).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Where("book_id = ?", book.ID).Delete(&schema.BookAuthor{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	bookAuthors := []schema.BookAuthor{}
+	for i, name := range authorNames {
+		author, err := findOrCreateAuthor(tx, name)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		bookAuthors = append(bookAuthors, schema.BookAuthor{BookID: book.ID, AuthorID: author.ID, Position: i, Author: author})
+	}
+	if len(bookAuthors) > 0 {
+		if err := tx.Omit("Author").Create(&bookAuthors).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	bookTags, err := replaceBookTags(tx, book.ID, tagNames)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	book.BookAuthors = bookAuthors
+	book.BookTags = bookTags
+	return nil
+}
+
+// replaceBookTags は本のタグを tagNames に付け替える。
+func replaceBookTags(tx *gorm.DB, bookID uint, tagNames []string) ([]schema.BookTag, error) {
+	if err := tx.Where("book_id = ?", bookID).Delete(&schema.BookTag{}).Error; err != nil {
+		return nil, err
+	}
+
+	bookTags := []schema.BookTag{}
+	for _, name := range tagNames {
+		tag, err := findOrCreateTag(tx, name)
+		if err != nil {
+			return nil, err
+		}
+		bookTags = append(bookTags, schema.BookTag{BookID: bookID, TagID: tag.ID, Tag: tag})
+	}
+	if len(bookTags) > 0 {
+		if err := tx.Omit("Tag").Create(&bookTags).Error; err != nil {
+			return nil, err
+		}
+	}
+	return bookTags, nil
+}
+
+// findOrCreateTag は名前のタグを返し、存在しない場合は作成する。findOrCreateAuthor と同じく同時の作成で中断しない。
+func findOrCreateTag(tx *gorm.DB, name string) (schema.Tag, error) {
+	tag := schema.Tag{Name: name}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoNothing: true,
+	}).Create(&tag).Error; err != nil {
+		return tag, err
+	}
+	if tag.ID != 0 {
+		return tag, nil
+	}
+
+	err := tx.Where("name = ?", name).First(&tag).Error
+	return tag, err
+}
+
+// findOrCreateAuthor は名前の著者を返し、存在しない場合は作成する。
+// 同じ著者の本が同時に登録されても一意制約の違反でトランザクションが中断しないよう、
+// 作成は ON CONFLICT DO NOTHING で行い、作成されなかった場合は既存の著者を読み直す。
+func findOrCreateAuthor(tx *gorm.DB, name string) (schema.Author, error) {
+	author := schema.Author{Name: name}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoNothing: true,
+	}).Create(&author).Error; err != nil {
+		return author, err
+	}
+	if author.ID != 0 {
+		return author, nil
+	}
+
+	err := tx.Where("name = ?", name).First(&author).Error
+	return author, err
+}
+
+// WithAuthors は著者を表示順に読み込むスコープ。
+func WithAuthors(db *gorm.DB) *gorm.DB {
+	return db.Preload("BookAuthors", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).Preload("BookAuthors.Author")
+}
+
+// WithTags はタグを付けた順に読み込むスコープ。
+func WithTags(db *gorm.DB) *gorm.DB {
+	return db.Preload("BookTags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("BookTags.Tag")
+}
+
+// setSearchText は検索用の正規化した書名と、書名・著者名・説明文をまとめたテキストを設定する。
+func setSearchText(book *schema.Book, authorNames []string) {
+	fields := []string{book.Title}
+	fields = append(fields, authorNames...)
+	fields = append(fields, book.Description)
+
+	book.SearchTitle = textnorm.Normalize(book.Title)
+	book.SearchText = textnorm.Normalize(strings.Join(fields, "\n"))
+}
+
+// BackfillBookSearchText は検索用テキストが未設定の本（検索機能の追加前に登録された本）に設定する。
+func BackfillBookSearchText() (int64, error) {
+	var updated int64
+	var books []schema.Book
+	result := database.Db.Scopes(WithAuthors).Where("search_text = ''").FindInBatches(&books, 100, func(tx *gorm.DB, batch int) error {
+		for i := range books {
+			authorNames := []string{}
+			for _, bookAuthor := range books[i].BookAuthors {
+				authorNames = append(authorNames, bookAuthor.Author.Name)
+			}
+			setSearchText(&books[i], authorNames)
+			if err := database.Db.Model(&books[i]).UpdateColumns(map[string]interface{}{
+				"search_title": books[i].SearchTitle,
+				"search_text":  books[i].SearchText,
+			}).Error; err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	})
+	return updated, result.Error
 }
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"errors"
+	"github.com/sayasurvey/golang/api/pagination"
+	"github.com/sayasurvey/golang/model/database"
+	"testing"
+)
+
+// 別の検索条件や方式のカーソルはデータベースに問い合わせる前に拒否する
+func TestSearchBooksRejectsCursorOfOtherSearch(t *testing.T) {
+	byTitle := BookSearch{Sort: BookSortTitle}
+	keyword := BookSearch{Query: "羅生門"}
+	titleCursor := &pagination.Cursor{Value: "らしょうもん", ID: 10, Order: byTitle.orderKey(nil)}
+
+	tests := []struct {
+		name   string
+		search BookSearch
+		cursor *pagination.Cursor
+	}{
+		{"other sort", BookSearch{Sort: BookSortCreatedAt}, titleCursor},
+		{"other direction", BookSearch{Sort: BookSortTitle, SortDesc: true}, titleCursor},
+		{"other filter", BookSearch{Sort: BookSortTitle, OwnerID: 1}, titleCursor},
+		{"keyset cursor for relevance", keyword, &pagination.Cursor{ID: 10, Order: keyword.orderKey([]string{"羅生門"})}},
+		{"offset cursor for keyset", byTitle, &pagination.Cursor{Offset: 50, Order: byTitle.orderKey(nil)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := pagination.Params{PerPage: pagination.DefaultPerPage, Cursor: tt.cursor}
+			if _, _, err := SearchBooks(tt.search, params); !errors.Is(err, pagination.ErrInvalidCursor) {
+				t.Errorf("got %v, want %v", err, pagination.ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestSearchBooksFiltersByTag(t *testing.T) {
+	db, recorder := newDryRunDB(t)
+	previous := database.Db
+	database.Db = db
+	t.Cleanup(func() { database.Db = previous })
+
+	params := pagination.Params{Page: 1, PerPage: pagination.DefaultPerPage, WithTotal: true}
+	if _, _, err := SearchBooks(BookSearch{Tag: "SF"}, params); err != nil {
+		t.Fatalf("SearchBooks: %v", err)
+	}
+
+	filter := "EXISTS (SELECT 1 FROM book_tags JOIN tags ON tags.id = book_tags.tag_id WHERE book_tags.book_id = books.id AND tags.name = 'SF')"
+	if !recorder.contains("SELECT count(*) FROM \"books\"", filter) {
+		t.Errorf("件数をタグで絞り込んでいません: %q", recorder.statements)
+	}
+	if !recorder.contains("SELECT * FROM \"books\"", filter) {
+		t.Errorf("一覧をタグで絞り込んでいません: %q", recorder.statements)
+	}
+}
+
+// タグの違う一覧のカーソルは使えない
+func TestSearchBooksRejectsCursorOfOtherTag(t *testing.T) {
+	sf := BookSearch{Tag: "SF"}
+	cursor := &pagination.Cursor{ID: 10, Order: sf.orderKey(nil)}
+
+	params := pagination.Params{PerPage: pagination.DefaultPerPage, Cursor: cursor}
+	if _, _, err := SearchBooks(BookSearch{Tag: "ミステリー"}, params); !errors.Is(err, pagination.ErrInvalidCursor) {
+		t.Errorf("got %v, want %v", err, pagination.ErrInvalidCursor)
+	}
+}
@@ -1,8 +1,10 @@
 package repository
 
 import (
+	"github.com/sayasurvey/golang/api/pagination"
 	"github.com/sayasurvey/golang/model/database"
 	"github.com/sayasurvey/golang/model/schema"
+	"strconv"
 	"time"
 )
 
@@ -77,11 +79,8 @@ func (r *BorrowedBookRepository) ReturnBook(borrowedBook *schema.BorrowedBook) e
 	return nil
 }
 
-func (r *BorrowedBookRepository) GetBorrowedBooksByUserID(userID uint) ([]schema.BorrowedBook, error) {
-	var borrowedBooks []schema.BorrowedBook
-	err := database.Db.Where("user_id = ?", userID).Find(&borrowedBooks).Error
-	if err != nil {
-		return nil, err
-	}
-	return borrowedBooks, nil
+func (r *BorrowedBookRepository) GetBorrowedBooksByUserID(userID uint, params pagination.Params) ([]schema.BorrowedBook, pagination.Result, error) {
+	query := database.Db.Model(&schema.BorrowedBook{}).Where("user_id = ?", userID)
+	order := pagination.OrderKey("borrowed_books", strconv.FormatUint(uint64(userID), 10))
+	return pagination.ByID(query, params, order, "id", func(borrowedBook schema.BorrowedBook) uint { return borrowedBook.ID })
 }
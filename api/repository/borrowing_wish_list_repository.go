@@ -1,8 +1,10 @@
 package repository
 
 import (
+	"github.com/sayasurvey/golang/api/pagination"
 	"github.com/sayasurvey/golang/model/database"
 	"github.com/sayasurvey/golang/model/schema"
+	"strconv"
 )
 
 type BorrowingWishListRepository struct{}
@@ -42,10 +44,20 @@ func (r *BorrowingWishListRepository) DeleteWishList(wishList *schema.BorrowingW
 	return database.Db.Delete(wishList).Error
 }
 
-func (r *BorrowingWishListRepository) GetWishListByUserID(userID uint) ([]schema.BorrowingWishList, error) {
-	var wishList []schema.BorrowingWishList
-	if err := database.Db.Where("user_id = ?", userID).Find(&wishList).Error; err != nil {
-		return nil, err
+func (r *BorrowingWishListRepository) GetWishListByUserID(userID uint, params pagination.Params) ([]schema.BorrowingWishList, pagination.Result, error) {
+	query := database.Db.Model(&schema.BorrowingWishList{}).Where("user_id = ?", userID)
+	order := pagination.OrderKey("borrowing_wish_lists", strconv.FormatUint(uint64(userID), 10))
+	return pagination.ByID(query, params, order, "id", func(wishList schema.BorrowingWishList) uint { return wishList.ID })
+}
+
+// FindWishListedBookIDs は bookIDs のうちユーザーがお気に入りに登録している本の ID を返す。
+func (r *BorrowingWishListRepository) FindWishListedBookIDs(userID uint, bookIDs []uint) ([]uint, error) {
+	wishListedBookIDs := []uint{}
+	if len(bookIDs) == 0 {
+		return wishListedBookIDs, nil
 	}
-	return wishList, nil
+	err := database.Db.Model(&schema.BorrowingWishList{}).
+		Where("user_id = ? AND book_id IN ?", userID, bookIDs).
+		Pluck("book_id", &wishListedBookIDs).Error
+	return wishListedBookIDs, err
 }
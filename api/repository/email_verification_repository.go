@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sayasurvey/golang/api/jwtkey"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"time"
+)
+
+const EmailVerificationTokenTTL = time.Hour * 24
+
+const emailVerificationPurpose = "verify_email"
+
+var ErrEmailVerificationTokenInvalid = errors.New("email verification token is invalid")
+
+type EmailVerificationRepository struct{}
+
+func NewEmailVerificationRepository() *EmailVerificationRepository {
+	return &EmailVerificationRepository{}
+}
+
+// GenerateVerificationToken は email 宛ての確認リンク用の署名付きトークンを生成する。
+// email は登録済みのアドレスか、変更待ちのアドレス（PendingEmail）のいずれか。
+// メールアドレスを含めて署名するため、アドレス変更後は古いリンクが使えなくなる。
+func (r *EmailVerificationRepository) GenerateVerificationToken(user *schema.User, email string) (string, error) {
+	return jwtkey.Current().Sign(jwt.MapClaims{
+		"purpose": emailVerificationPurpose,
+		"user_id": user.ID,
+		"email":   email,
+		"exp":     time.Now().Add(EmailVerificationTokenTTL).Unix(),
+	})
+}
+
+// VerifyEmail はトークンを検証し、ユーザーのメールアドレスを確認済みにする。
+// 変更待ちのアドレス宛てのトークンの場合は、メールアドレスを変更後のものに切り替える。
+func (r *EmailVerificationRepository) VerifyEmail(tokenString string) (*schema.User, error) {
+	token, err := jwtkey.Current().Parse(tokenString)
+	if err != nil || !token.Valid {
+		return nil, ErrEmailVerificationTokenInvalid
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != emailVerificationPurpose {
+		return nil, ErrEmailVerificationTokenInvalid
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, ErrEmailVerificationTokenInvalid
+	}
+	email, _ := claims["email"].(string)
+
+	var user schema.User
+	if err := database.Db.First(&user, uint(userID)).Error; err != nil {
+		return nil, ErrEmailVerificationTokenInvalid
+	}
+	if user.PendingEmail != "" && user.PendingEmail == email {
+		var count int64
+		if err := database.Db.Model(&schema.User{}).Where("email = ? AND id <> ?", email, user.ID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, ErrEmailTaken
+		}
+
+		now := time.Now()
+		if err := database.Db.Model(&user).Updates(map[string]interface{}{
+			"email":         email,
+			"pending_email": "",
+			"verified_at":   now,
+		}).Error; err != nil {
+			return nil, err
+		}
+		user.Email = email
+		user.PendingEmail = ""
+		user.VerifiedAt = &now
+		return &user, nil
+	}
+
+	if user.Email != email {
+		return nil, ErrEmailVerificationTokenInvalid
+	}
+
+	if user.VerifiedAt == nil {
+		now := time.Now()
+		if err := database.Db.Model(&user).Update("verified_at", now).Error; err != nil {
+			return nil, err
+		}
+		user.VerifiedAt = &now
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInviteInvalid       = errors.New("invite code is invalid")
+	ErrInviteRequired      = errors.New("invite code is required")
+	ErrInviteNotFound      = errors.New("invite not found")
+	ErrEmailDomainRejected = errors.New("email domain is not allowed")
+)
+
+type InviteRepository struct{}
+
+func NewInviteRepository() *InviteRepository {
+	return &InviteRepository{}
+}
+
+// CreateInvite は招待コードを発行し、平文のコードを返す。平文はこの時にしか取得できない。
+func (r *InviteRepository) CreateInvite(createdByID uint, note string, maxUses int, expiresAt *time.Time) (*schema.Invite, string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+
+	invite := schema.Invite{
+		CreatedByID: createdByID,
+		Prefix:      code[:4],
+		CodeHash:    hashToken(normalizeInviteCode(code)),
+		Note:        note,
+		MaxUses:     maxUses,
+		ExpiresAt:   expiresAt,
+	}
+	if err := database.Db.Create(&invite).Error; err != nil {
+		return nil, "", err
+	}
+	return &invite, code, nil
+}
+
+// GetInvites は失効させていない招待コードを新しい順に返す。使い切ったものや期限切れのものも含む。
+func (r *InviteRepository) GetInvites() ([]schema.Invite, error) {
+	var invites []schema.Invite
+	err := database.Db.Where("revoked_at IS NULL").Order("created_at DESC").Find(&invites).Error
+	return invites, err
+}
+
+func (r *InviteRepository) RevokeInvite(id uint) error {
+	result := database.Db.Model(&schema.Invite{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// RegisterWithInvite は招待コードの利用回数を1つ消費してユーザーを作成する。
+// コードが無効・期限切れ・使い切りの場合は ErrInviteInvalid を返し、ユーザーは作成しない。
+func (r *InviteRepository) RegisterWithInvite(code, name, email, password string) (*schema.User, error) {
+	user, err := newUser(name, email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := database.Db.Begin()
+
+	if err := consumeInvite(tx, code); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Create(user).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// consumeInvite は招待コードの利用回数を1つ消費する。使えないコードの場合は ErrInviteInvalid。
+// ユーザーの作成と同じトランザクションで呼ぶ。
+func consumeInvite(tx *gorm.DB, code string) error {
+	result := tx.Model(&schema.Invite{}).
+		Where("code_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?) AND use_count < max_uses",
+			hashToken(normalizeInviteCode(code)), time.Now()).
+		Update("use_count", gorm.Expr("use_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInviteInvalid
+	}
+	return nil
+}
+
+// InviteRequired は登録に招待コードが必要かを返す。未設定の場合は必要とする。
+func (r *InviteRepository) InviteRequired() (bool, error) {
+	value, _, err := NewSettingRepository().GetSetting(SettingRegistrationInviteRequired)
+	if err != nil {
+		return true, err
+	}
+	return value != "false", nil
+}
+
+func (r *InviteRepository) SetInviteRequired(required bool) error {
+	value := "true"
+	if !required {
+		value = "false"
+	}
+	return NewSettingRepository().SetSetting(SettingRegistrationInviteRequired, value)
+}
+
+// AllowedDomains は登録を許可するメールアドレスのドメインを返す。空の場合は制限しない。
+func (r *InviteRepository) AllowedDomains() ([]string, error) {
+	value, _, err := NewSettingRepository().GetSetting(SettingRegistrationAllowedDomains)
+	if err != nil {
+		return nil, err
+	}
+
+	var domains []string
+	for _, domain := range strings.Split(value, ",") {
+		if domain = normalizeDomain(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains, nil
+}
+
+func (r *InviteRepository) SetAllowedDomains(domains []string) error {
+	var normalized []string
+	for _, domain := range domains {
+		if domain = normalizeDomain(domain); domain != "" {
+			normalized = append(normalized, domain)
+		}
+	}
+	return NewSettingRepository().SetSetting(SettingRegistrationAllowedDomains, strings.Join(normalized, ","))
+}
+
+// CheckEmailDomain はメールアドレスのドメインが許可リストにあるかを確認する。
+// サブドメインは許可しない（example.com を許可しても sub.example.com は登録できない）。
+func (r *InviteRepository) CheckEmailDomain(email string) error {
+	domains, err := r.AllowedDomains()
+	if err != nil {
+		return err
+	}
+	if len(domains) == 0 {
+		return nil
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ErrEmailDomainRejected
+	}
+	emailDomain := normalizeDomain(email[at+1:])
+	for _, domain := range domains {
+		if emailDomain == domain {
+			return nil
+		}
+	}
+	return ErrEmailDomainRejected
+}
+
+func normalizeDomain(domain string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "@")
+}
+
+func normalizeInviteCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
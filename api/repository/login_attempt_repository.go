@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"errors"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoginAttemptStore はログイン失敗回数の保存先。
+// 本番は DB、テストではメモリ上の実装を使う。
+type LoginAttemptStore interface {
+	// Get は key の記録を返す。記録がない場合は nil を返す。
+	Get(key string) (*schema.LoginAttempt, error)
+	// Update は key の記録を他の更新と排他して読み出し、fn で書き換えて保存する。
+	// 記録がない場合は Key だけを設定した値を fn に渡す。
+	Update(key string, fn func(attempt *schema.LoginAttempt)) error
+	Delete(key string) error
+}
+
+type DBLoginAttemptStore struct{}
+
+func NewDBLoginAttemptStore() *DBLoginAttemptStore {
+	return &DBLoginAttemptStore{}
+}
+
+func (s *DBLoginAttemptStore) Get(key string) (*schema.LoginAttempt, error) {
+	var attempt schema.LoginAttempt
+	err := database.Db.Where("key = ?", key).First(&attempt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// Update は行を SELECT ... FOR UPDATE でロックしてから更新する。
+// 同じキーへの同時の失敗で加算が失われ、ロックアウトの上限を超えて試行できることを防ぐ。
+func (s *DBLoginAttemptStore) Update(key string, fn func(attempt *schema.LoginAttempt)) error {
+	tx := database.Db.Begin()
+
+	// 初回の失敗でもロックを取れるよう、先に行を作っておく
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoNothing: true,
+	}).Create(&schema.LoginAttempt{Key: key}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var attempt schema.LoginAttempt
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&attempt).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	fn(&attempt)
+	if err := tx.Save(&attempt).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func (s *DBLoginAttemptStore) Delete(key string) error {
+	return database.Db.Unscoped().Where("key = ?", key).Delete(&schema.LoginAttempt{}).Error
+}
+
+func (s *DBLoginAttemptStore) PurgeStaleAttempts(olderThan time.Duration) (int64, error) {
+	threshold := time.Now().Add(-olderThan)
+	result := database.Db.Unscoped().
+		Where("last_failed_at < ? AND blocked_until < ?", threshold, time.Now()).
+		Delete(&schema.LoginAttempt{})
+	return result.RowsAffected, result.Error
+}
+
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]schema.LoginAttempt
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: make(map[string]schema.LoginAttempt)}
+}
+
+func (s *MemoryLoginAttemptStore) Get(key string) (*schema.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	return &attempt, nil
+}
+
+func (s *MemoryLoginAttemptStore) Update(key string, fn func(attempt *schema.LoginAttempt)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = schema.LoginAttempt{Key: key}
+	}
+	fn(&attempt)
+	s.attempts[key] = attempt
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// LoginThrottle はアカウント単位と IP 単位の失敗回数から、ログインを試行してよいかを判定する。
+// 失敗が続くと次の試行までの待ち時間を段階的に延ばし、上限に達したら一定時間ロックする。
+type LoginThrottle struct {
+	Store              LoginAttemptStore
+	MaxAccountFailures int
+	MaxIPFailures      int
+	LockoutDuration    time.Duration
+	// FailureWindow の間失敗がなければ失敗回数をリセットする
+	FailureWindow time.Duration
+	Now           func() time.Time
+}
+
+func NewLoginThrottle(store LoginAttemptStore) *LoginThrottle {
+	return &LoginThrottle{
+		Store:              store,
+		MaxAccountFailures: envInt("LOGIN_MAX_FAILURES", 10),
+		MaxIPFailures:      envInt("LOGIN_IP_MAX_FAILURES", 50),
+		LockoutDuration:    time.Duration(envInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute,
+		FailureWindow:      time.Duration(envInt("LOGIN_FAILURE_WINDOW_MINUTES", 15)) * time.Minute,
+		Now:                time.Now,
+	}
+}
+
+func AccountAttemptKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// RetryAfter はいずれかのキーが待機中またはロック中であれば、試行可能になるまでの時間を返す。
+func (t *LoginThrottle) RetryAfter(keys ...string) (time.Duration, error) {
+	now := t.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		attempt, err := t.Store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if attempt != nil && attempt.BlockedUntil.After(now) {
+			if d := attempt.BlockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait, nil
+}
+
+// RecordFailure は accountKey と ipKey の失敗回数を加算し、待ち時間またはロックを設定する。
+func (t *LoginThrottle) RecordFailure(accountKey, ipKey string) error {
+	if err := t.recordFailure(accountKey, t.MaxAccountFailures); err != nil {
+		return err
+	}
+	return t.recordFailure(ipKey, t.MaxIPFailures)
+}
+
+func (t *LoginThrottle) recordFailure(key string, maxFailures int) error {
+	now := t.Now()
+	return t.Store.Update(key, func(attempt *schema.LoginAttempt) {
+		if now.Sub(attempt.LastFailedAt) > t.FailureWindow && !attempt.BlockedUntil.After(now) {
+			attempt.Failures = 0
+		}
+
+		attempt.Failures++
+		attempt.LastFailedAt = now
+		if attempt.Failures >= maxFailures {
+			attempt.BlockedUntil = now.Add(t.LockoutDuration)
+			attempt.Failures = 0
+		} else {
+			attempt.BlockedUntil = now.Add(progressiveDelay(attempt.Failures))
+		}
+	})
+}
+
+// Reset はログイン成功時や管理者によるロック解除時に記録を消す。
+func (t *LoginThrottle) Reset(key string) error {
+	return t.Store.Delete(key)
+}
+
+// progressiveDelay は 3 回目以降の失敗から 1 秒ずつ倍にした待ち時間を返す（最大 30 秒）。
+func progressiveDelay(failures int) time.Duration {
+	if failures < 3 {
+		return 0
+	}
+	delay := time.Second << uint(failures-3)
+	if delay > 30*time.Second || delay <= 0 {
+		return 30 * time.Second
+	}
+	return delay
+}
+
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccountKey = "account:user@example.com"
+	testIPKey      = "ip:192.0.2.1"
+)
+
+// fakeClock は Now を手動で進めるための時計
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestThrottle() (*LoginThrottle, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)}
+	return &LoginThrottle{
+		Store:              NewMemoryLoginAttemptStore(),
+		MaxAccountFailures: 5,
+		MaxIPFailures:      8,
+		LockoutDuration:    15 * time.Minute,
+		FailureWindow:      15 * time.Minute,
+		Now:                clock.Now,
+	}, clock
+}
+
+func recordFailures(t *testing.T, throttle *LoginThrottle, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := throttle.RecordFailure(testAccountKey, testIPKey); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+}
+
+func retryAfter(t *testing.T, throttle *LoginThrottle, keys ...string) time.Duration {
+	t.Helper()
+	wait, err := throttle.RetryAfter(keys...)
+	if err != nil {
+		t.Fatalf("RetryAfter: %v", err)
+	}
+	return wait
+}
+
+func TestLoginThrottleProgressiveDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		throttle, _ := newTestThrottle()
+		recordFailures(t, throttle, tt.failures)
+		if got := retryAfter(t, throttle, testAccountKey); got != tt.want {
+			t.Errorf("after %d failures: got %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginThrottleLocksAccountAfterMaxFailures(t *testing.T) {
+	throttle, clock := newTestThrottle()
+	recordFailures(t, throttle, throttle.MaxAccountFailures)
+
+	if got := retryAfter(t, throttle, testAccountKey, testIPKey); got != throttle.LockoutDuration {
+		t.Fatalf("got %v, want %v", got, throttle.LockoutDuration)
+	}
+
+	clock.Advance(throttle.LockoutDuration - time.Minute)
+	if got := retryAfter(t, throttle, testAccountKey); got != time.Minute {
+		t.Errorf("during lockout: got %v, want %v", got, time.Minute)
+	}
+
+	clock.Advance(time.Minute)
+	if got := retryAfter(t, throttle, testAccountKey); got != 0 {
+		t.Errorf("after lockout: got %v, want 0", got)
+	}
+}
+
+func TestLoginThrottleLocksIPSeparately(t *testing.T) {
+	throttle, _ := newTestThrottle()
+	for i := 0; i < throttle.MaxIPFailures; i++ {
+		// アカウントを変えながら失敗しても IP 単位で止める
+		accountKey := AccountAttemptKey(string(rune('a'+i)) + "@example.com")
+		if err := throttle.RecordFailure(accountKey, testIPKey); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+
+	if got := retryAfter(t, throttle, testIPKey); got != throttle.LockoutDuration {
+		t.Errorf("got %v, want %v", got, throttle.LockoutDuration)
+	}
+}
+
+func TestLoginThrottleResetsFailuresAfterWindow(t *testing.T) {
+	throttle, clock := newTestThrottle()
+	recordFailures(t, throttle, throttle.MaxAccountFailures-1)
+
+	clock.Advance(throttle.FailureWindow + time.Second)
+	recordFailures(t, throttle, 1)
+
+	if got := retryAfter(t, throttle, testAccountKey); got != 0 {
+		t.Errorf("got %v, want 0", got)
+	}
+	attempt, err := throttle.Store.Get(testAccountKey)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if attempt.Failures != 1 {
+		t.Errorf("failures: got %d, want 1", attempt.Failures)
+	}
+}
+
+func TestLoginThrottleReset(t *testing.T) {
+	throttle, _ := newTestThrottle()
+	recordFailures(t, throttle, throttle.MaxAccountFailures)
+
+	if err := throttle.Reset(testAccountKey); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if got := retryAfter(t, throttle, testAccountKey); got != 0 {
+		t.Errorf("got %v, want 0", got)
+	}
+}
+
+func TestLoginThrottleConcurrentFailures(t *testing.T) {
+	throttle, _ := newTestThrottle()
+	throttle.MaxAccountFailures = 1000
+	throttle.MaxIPFailures = 1000
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := throttle.RecordFailure(testAccountKey, testIPKey); err != nil {
+				t.Errorf("RecordFailure: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, key := range []string{testAccountKey, testIPKey} {
+		attempt, err := throttle.Store.Get(key)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if attempt.Failures != n {
+			t.Errorf("%s failures: got %d, want %d", key, attempt.Failures, n)
+		}
+	}
+}
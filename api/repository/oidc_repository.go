@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"errors"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const OIDCAuthRequestTTL = time.Minute * 10
+
+var ErrOIDCAuthRequestInvalid = errors.New("oidc auth request is invalid")
+
+type OIDCRepository struct{}
+
+func NewOIDCRepository() *OIDCRepository {
+	return &OIDCRepository{}
+}
+
+func (r *OIDCRepository) CreateAuthRequest(state, nonce, codeVerifier string) error {
+	authRequest := schema.OIDCAuthRequest{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(OIDCAuthRequestTTL),
+	}
+	return database.Db.Create(&authRequest).Error
+}
+
+// ConsumeAuthRequest は state に対応する認可リクエストを取り出して削除する。
+// 同じ state は一度しか使えない。
+func (r *OIDCRepository) ConsumeAuthRequest(state string) (*schema.OIDCAuthRequest, error) {
+	var authRequest schema.OIDCAuthRequest
+	if err := database.Db.Where("state = ?", state).First(&authRequest).Error; err != nil {
+		return nil, ErrOIDCAuthRequestInvalid
+	}
+
+	result := database.Db.Unscoped().Delete(&authRequest)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(authRequest.ExpiresAt) {
+		return nil, ErrOIDCAuthRequestInvalid
+	}
+	return &authRequest, nil
+}
+
+func (r *OIDCRepository) PurgeExpiredAuthRequests() (int64, error) {
+	result := database.Db.Unscoped().Where("expires_at < ?", time.Now()).Delete(&schema.OIDCAuthRequest{})
+	return result.RowsAffected, result.Error
+}
+
+// FindOrCreateUser は issuer と subject で紐付け済みのユーザーを返す。
+// 未連携の場合は確認済みメールアドレスで既存ユーザーに紐付け、該当がなければ新規作成する。
+// メール未確認の既存ユーザーに紐付ける場合は linkExistingUser で登録時の認証情報を無効にする。
+// 新規作成はパスワードでの登録と同じく許可ドメインと招待の設定に従う。招待が必要な場合は inviteCode を消費し、
+// 指定がなければ ErrInviteRequired、使えないコードであれば ErrInviteInvalid を返す。
+func (r *OIDCRepository) FindOrCreateUser(issuer, subject, email, name, inviteCode string) (*schema.User, error) {
+	var user schema.User
+
+	var identity schema.UserIdentity
+	err := database.Db.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error
+	if err == nil {
+		if err := database.Db.First(&user, identity.UserID).Error; err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	now := time.Now()
+	tx := database.Db.Begin()
+
+	err = tx.Where("LOWER(email) = ?", strings.ToLower(email)).First(&user).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if err := checkRegistration(tx, email, inviteCode); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		// パスワードログインはできないよう、誰も知らないランダムなパスワードを設定する
+		hashedPassword, err := randomPasswordHash()
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if name == "" {
+			name = strings.Split(email, "@")[0]
+		}
+		user = schema.User{
+			Name:       name,
+			Email:      email,
+			Password:   hashedPassword,
+			Role:       schema.UserRole,
+			VerifiedAt: &now,
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	case err != nil:
+		tx.Rollback()
+		return nil, err
+	default:
+		if err := linkExistingUser(tx, &user, now); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Create(&schema.UserIdentity{UserID: user.ID, Issuer: issuer, Subject: subject}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// checkRegistration はメールアドレスのドメインが許可されているかを確認し、招待が必要な場合は招待コードを消費する。
+func checkRegistration(tx *gorm.DB, email, inviteCode string) error {
+	inviteRepo := NewInviteRepository()
+	if err := inviteRepo.CheckEmailDomain(email); err != nil {
+		return err
+	}
+
+	required, err := inviteRepo.InviteRequired()
+	if err != nil {
+		return err
+	}
+	if !required {
+		return nil
+	}
+	if inviteCode == "" {
+		return ErrInviteRequired
+	}
+	return consumeInvite(tx, inviteCode)
+}
+
+// linkExistingUser は既存ユーザーに ID プロバイダーのアカウントを紐付ける前の処理を行う。
+// メール確認済みのユーザーはそのまま紐付ける。メール未確認のユーザーは第三者がこのアドレスで先に登録した
+// 可能性があるため、パスワードを誰も知らない値に変え、登録者が作ったセッション・API キー・
+// 二要素認証の設定を無効にしてから、ID プロバイダーで確認されたメールアドレスとして確認済みにする。
+func linkExistingUser(tx *gorm.DB, user *schema.User, now time.Time) error {
+	if user.VerifiedAt != nil {
+		return nil
+	}
+
+	hashedPassword, err := randomPasswordHash()
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"password":    hashedPassword,
+		"verified_at": now,
+	}).Error; err != nil {
+		return err
+	}
+
+	if _, err := RevokeUserSessions(tx, user.ID, 0); err != nil {
+		return err
+	}
+	if err := RevokeUserAPIKeys(tx, user.ID); err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&schema.TwoFactor{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("user_id = ?", user.ID).Delete(&schema.RecoveryCode{}).Error
+}
+
+// randomPasswordHash はパスワードログインに使えないよう、誰も知らないランダムな値のハッシュを返す。
+func randomPasswordHash() (string, error) {
+	password, err := generateTokenID()
+	if err != nil {
+		return "", err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"github.com/sayasurvey/golang/model/schema"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statementRecorder は実行しようとした SQL を記録する logger.Interface の実装
+type statementRecorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (r *statementRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, sql)
+}
+
+func (r *statementRecorder) contains(prefix, fragment string) bool {
+	for _, sql := range r.statements {
+		if strings.HasPrefix(sql, prefix) && strings.Contains(sql, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// newDryRunDB は SQL を組み立てるだけで実行しない DB を返す。テスト環境に PostgreSQL がないため。
+// 本番ではトランザクション内の tx を渡すので、暗黙のトランザクションは使わない。
+func newDryRunDB(t *testing.T) (*gorm.DB, *statementRecorder) {
+	t.Helper()
+	recorder := &statementRecorder{Interface: logger.Discard}
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 user=test dbname=test"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 recorder,
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open: %v", err)
+	}
+	return db, recorder
+}
+
+func TestLinkExistingUser(t *testing.T) {
+	const registeredPassword = "password-set-by-whoever-registered"
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(registeredPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiedAt := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+
+	t.Run("verified user", func(t *testing.T) {
+		db, recorder := newDryRunDB(t)
+		user := &schema.User{Model: gorm.Model{ID: 42}, Email: "user@example.com", Password: string(hashedPassword), VerifiedAt: &verifiedAt}
+
+		if err := linkExistingUser(db, user, now); err != nil {
+			t.Fatalf("linkExistingUser: %v", err)
+		}
+		if len(recorder.statements) != 0 {
+			t.Errorf("メール確認済みのユーザーを変更しています: %q", recorder.statements)
+		}
+		if user.Password != string(hashedPassword) || !user.VerifiedAt.Equal(verifiedAt) {
+			t.Error("メール確認済みのユーザーのパスワードか確認日時が変わっています")
+		}
+	})
+
+	t.Run("unverified user", func(t *testing.T) {
+		db, recorder := newDryRunDB(t)
+		user := &schema.User{Model: gorm.Model{ID: 42}, Email: "user@example.com", Password: string(hashedPassword)}
+
+		if err := linkExistingUser(db, user, now); err != nil {
+			t.Fatalf("linkExistingUser: %v", err)
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(registeredPassword)) == nil {
+			t.Error("登録時のパスワードでログインできる状態が残っています")
+		}
+		if user.VerifiedAt == nil || !user.VerifiedAt.Equal(now) {
+			t.Errorf("verified_at: got %v, want %v", user.VerifiedAt, now)
+		}
+
+		expected := []struct {
+			prefix   string
+			fragment string
+		}{
+			{`UPDATE "users"`, `"password"=`},
+			{`UPDATE "users"`, `"verified_at"=`},
+			{`SELECT "id" FROM "sessions"`, `user_id = 42`},
+			{`UPDATE "refresh_tokens"`, `user_id = 42`},
+			{`UPDATE "api_keys"`, `user_id = 42`},
+			{`DELETE FROM "two_factors"`, `user_id = 42`},
+			{`DELETE FROM "recovery_codes"`, `user_id = 42`},
+		}
+		for _, e := range expected {
+			if !recorder.contains(e.prefix, e.fragment) {
+				t.Errorf("%s ... %s が実行されていません: %q", e.prefix, e.fragment, recorder.statements)
+			}
+		}
+	})
+}
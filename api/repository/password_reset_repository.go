@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+const PasswordResetTokenTTL = time.Hour
+
+var ErrPasswordResetTokenInvalid = errors.New("password reset token is invalid")
+
+type PasswordResetRepository struct{}
+
+func NewPasswordResetRepository() *PasswordResetRepository {
+	return &PasswordResetRepository{}
+}
+
+// CreateResetToken はパスワード再設定用のトークンを発行し、平文のトークンを返す。
+// DB にはハッシュだけを保存する。
+func (r *PasswordResetRepository) CreateResetToken(userID uint) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	resetToken := schema.PasswordResetToken{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(PasswordResetTokenTTL),
+	}
+	if err := database.Db.Create(&resetToken).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ResetPassword はトークンを使用済みにしてパスワードを更新する。
+// 更新後はそのユーザーの全てのセッションと API キーを失効させる。
+func (r *PasswordResetRepository) ResetPassword(token, password string) (*schema.User, error) {
+	var resetToken schema.PasswordResetToken
+	err := database.Db.
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), time.Now()).
+		First(&resetToken).Error
+	if err != nil {
+		return nil, ErrPasswordResetTokenInvalid
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := database.Db.Begin()
+
+	result := tx.Model(&schema.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", resetToken.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		tx.Rollback()
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, ErrPasswordResetTokenInvalid
+	}
+
+	if err := tx.Model(&schema.User{}).Where("id = ?", resetToken.UserID).Update("password", string(hashedPassword)).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if _, err := RevokeUserSessions(tx, resetToken.UserID, 0); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := RevokeUserAPIKeys(tx, resetToken.UserID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	var user schema.User
+	if err := database.Db.First(&user, resetToken.UserID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *PasswordResetRepository) PurgeExpiredResetTokens() (int64, error) {
+	result := database.Db.Unscoped().Where("expires_at < ?", time.Now()).Delete(&schema.PasswordResetToken{})
+	return result.RowsAffected, result.Error
+}
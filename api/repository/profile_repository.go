@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"errors"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrEmailTaken              = errors.New("email is already taken")
+	ErrCurrentPasswordMismatch = errors.New("current password does not match")
+)
+
+type ProfileRepository struct{}
+
+func NewProfileRepository() *ProfileRepository {
+	return &ProfileRepository{}
+}
+
+// ProfileUpdate は変更する項目。nil の項目は変更しない。
+type ProfileUpdate struct {
+	Name         *string
+	AvatarURL    *string
+	EmailVisible *bool
+}
+
+func (r *ProfileRepository) UpdateProfile(userID uint, update ProfileUpdate) error {
+	fields := map[string]interface{}{}
+	if update.Name != nil {
+		fields["name"] = *update.Name
+	}
+	if update.AvatarURL != nil {
+		fields["avatar_url"] = *update.AvatarURL
+	}
+	if update.EmailVisible != nil {
+		fields["email_visible"] = *update.EmailVisible
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return database.Db.Model(&schema.User{}).Where("id = ?", userID).Updates(fields).Error
+}
+
+// RequestEmailChange は変更後のメールアドレスを確認待ちとして保存する。
+// 確認リンクが開かれるまでは現在のメールアドレスのままログインできる。
+func (r *ProfileRepository) RequestEmailChange(userID uint, email string) error {
+	var count int64
+	if err := database.Db.Model(&schema.User{}).Where("email = ? AND id <> ?", email, userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrEmailTaken
+	}
+
+	return database.Db.Model(&schema.User{}).Where("id = ?", userID).Update("pending_email", email).Error
+}
+
+func (r *ProfileRepository) CancelEmailChange(userID uint) error {
+	return database.Db.Model(&schema.User{}).Where("id = ?", userID).Update("pending_email", "").Error
+}
+
+// ChangePassword は現在のパスワードを確認してから更新する。
+// 更新後は currentSessionID 以外の全てのセッションとリフレッシュトークン、全ての API キーを失効させる。
+// API キーは変更前のパスワードで発行されたものであり、漏えいを疑って変更した場合に残ると意味がないため。
+func (r *ProfileRepository) ChangePassword(userID, currentSessionID uint, currentPassword, newPassword string) error {
+	var user schema.User
+	if err := database.Db.First(&user, userID).Error; err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)); err != nil {
+		return ErrCurrentPasswordMismatch
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	tx := database.Db.Begin()
+
+	if err := tx.Model(&schema.User{}).Where("id = ?", userID).Update("password", string(hashedPassword)).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := RevokeUserSessions(tx, userID, currentSessionID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := RevokeUserAPIKeys(tx, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
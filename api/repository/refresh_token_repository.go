@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+	"time"
+)
+
+const RefreshTokenTTL = time.Hour * 24 * 14
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	ErrRefreshTokenReused   = errors.New("refresh token reused")
+)
+
+type RefreshTokenRepository struct{}
+
+func NewRefreshTokenRepository() *RefreshTokenRepository {
+	return &RefreshTokenRepository{}
+}
+
+// IssueRefreshToken はセッションに紐づく新しいトークンファミリーを作成し、平文のリフレッシュトークンを返す。
+func (r *RefreshTokenRepository) IssueRefreshToken(userID, sessionID uint) (string, error) {
+	familyID, err := generateTokenID()
+	if err != nil {
+		return "", err
+	}
+	return r.createRefreshToken(database.Db, userID, sessionID, familyID)
+}
+
+// RotateRefreshToken は受け取ったリフレッシュトークンを使用済みにし、同じファミリーの新しいトークンを発行する。
+// 使用済み・失効済みのトークンが再利用された場合はファミリー全体を失効させて ErrRefreshTokenReused を返す。
+// 新しいトークンと合わせて、ユーザーとセッション ID を返す。
+func (r *RefreshTokenRepository) RotateRefreshToken(token string) (*schema.User, uint, string, error) {
+	var refreshToken schema.RefreshToken
+	if err := database.Db.Where("token_hash = ?", hashToken(token)).First(&refreshToken).Error; err != nil {
+		return nil, 0, "", ErrRefreshTokenNotFound
+	}
+
+	if refreshToken.UsedAt != nil || refreshToken.RevokedAt != nil {
+		if err := r.RevokeFamily(refreshToken.FamilyID); err != nil {
+			return nil, 0, "", err
+		}
+		return nil, 0, "", ErrRefreshTokenReused
+	}
+
+	if time.Now().After(refreshToken.ExpiresAt) {
+		return nil, 0, "", ErrRefreshTokenExpired
+	}
+
+	var user schema.User
+	if err := database.Db.First(&user, refreshToken.UserID).Error; err != nil {
+		return nil, 0, "", err
+	}
+
+	tx := database.Db.Begin()
+
+	// 並行して同じトークンが使われた場合に二重発行しないよう、未使用の場合だけ更新する
+	result := tx.Model(&schema.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", refreshToken.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		tx.Rollback()
+		return nil, 0, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		if err := r.RevokeFamily(refreshToken.FamilyID); err != nil {
+			return nil, 0, "", err
+		}
+		return nil, 0, "", ErrRefreshTokenReused
+	}
+
+	newToken, err := r.createRefreshToken(tx, refreshToken.UserID, refreshToken.SessionID, refreshToken.FamilyID)
+	if err != nil {
+		tx.Rollback()
+		return nil, 0, "", err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, 0, "", err
+	}
+
+	return &user, refreshToken.SessionID, newToken, nil
+}
+
+// RevokeRefreshToken は受け取ったリフレッシュトークンのファミリー全体を失効させる。
+func (r *RefreshTokenRepository) RevokeRefreshToken(token string) error {
+	var refreshToken schema.RefreshToken
+	if err := database.Db.Where("token_hash = ?", hashToken(token)).First(&refreshToken).Error; err != nil {
+		return ErrRefreshTokenNotFound
+	}
+	return r.RevokeFamily(refreshToken.FamilyID)
+}
+
+// RevokeFamily はファミリー全体と、それが属するセッションを失効させる。
+func (r *RefreshTokenRepository) RevokeFamily(familyID string) error {
+	var sessionIDs []uint
+	if err := database.Db.Model(&schema.RefreshToken{}).
+		Where("family_id = ? AND session_id <> 0", familyID).
+		Distinct().Pluck("session_id", &sessionIDs).Error; err != nil {
+		return err
+	}
+
+	if len(sessionIDs) > 0 {
+		if err := database.Db.Model(&schema.Session{}).
+			Where("id IN ? AND revoked_at IS NULL", sessionIDs).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+	}
+
+	return database.Db.Model(&schema.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *RefreshTokenRepository) PurgeExpiredRefreshTokens() (int64, error) {
+	result := database.Db.Unscoped().Where("expires_at < ?", time.Now()).Delete(&schema.RefreshToken{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *RefreshTokenRepository) createRefreshToken(db *gorm.DB, userID, sessionID uint, familyID string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	refreshToken := schema.RefreshToken{
+		UserID:    userID,
+		SessionID: sessionID,
+		TokenHash: hashToken(token),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	if err := db.Create(&refreshToken).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"errors"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// 最終アクセス日時の更新はこの間隔より細かくは行わない
+const sessionLastSeenInterval = time.Minute
+
+// maxUserAgentLength は保存する User-Agent の最大文字数（varchar(512)）
+const maxUserAgentLength = 512
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionRepository struct{}
+
+func NewSessionRepository() *SessionRepository {
+	return &SessionRepository{}
+}
+
+func (r *SessionRepository) CreateSession(userID uint, userAgent, ip string) (*schema.Session, error) {
+	session := schema.Session{
+		UserID:     userID,
+		UserAgent:  truncateUserAgent(userAgent),
+		IP:         ip,
+		LastSeenAt: time.Now(),
+	}
+	if err := database.Db.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// truncateUserAgent は User-Agent を保存できる長さに切り詰める。
+// マルチバイト文字の途中で切ったり不正な UTF-8 をそのまま渡したりすると PostgreSQL が保存を拒否するため、文字単位で切る。
+func truncateUserAgent(userAgent string) string {
+	runes := []rune(strings.ToValidUTF8(userAgent, ""))
+	if len(runes) > maxUserAgentLength {
+		runes = runes[:maxUserAgentLength]
+	}
+	return string(runes)
+}
+
+// Touch はセッションが有効か確認し、有効であれば最終アクセス日時と IP を更新する。
+func (r *SessionRepository) Touch(sessionID uint, ip string) (bool, error) {
+	var session schema.Session
+	err := database.Db.Where("id = ? AND revoked_at IS NULL", sessionID).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if time.Since(session.LastSeenAt) > sessionLastSeenInterval || session.IP != ip {
+		database.Db.Model(&session).Updates(map[string]interface{}{"last_seen_at": time.Now(), "ip": ip})
+	}
+	return true, nil
+}
+
+// LoggedInSince はセッションが有効で、since 以降のログインで作られたものかを返す。
+// 退会など改めて本人確認が必要な操作で、直前にログインし直したことの確認に使う。
+func (r *SessionRepository) LoggedInSince(userID, sessionID uint, since time.Time) (bool, error) {
+	var count int64
+	err := database.Db.Model(&schema.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND created_at >= ?", sessionID, userID, since).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *SessionRepository) GetActiveSessions(userID uint) ([]schema.Session, error) {
+	var sessions []schema.Session
+	err := database.Db.Where("user_id = ? AND revoked_at IS NULL", userID).Order("last_seen_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeSession は利用者自身のセッションを1つ失効させる。
+func (r *SessionRepository) RevokeSession(userID, sessionID uint) error {
+	tx := database.Db.Begin()
+
+	revoked, err := revokeSessions(tx.Where("id = ? AND user_id = ?", sessionID, userID))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if revoked == 0 {
+		tx.Rollback()
+		return ErrSessionNotFound
+	}
+
+	return tx.Commit().Error
+}
+
+// RevokeOtherSessions は currentSessionID 以外の全てのセッションを失効させる。
+// currentSessionID が 0 の場合は全てのセッションが対象になる。
+func (r *SessionRepository) RevokeOtherSessions(userID, currentSessionID uint) (int64, error) {
+	tx := database.Db.Begin()
+
+	revoked, err := RevokeUserSessions(tx, userID, currentSessionID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+	return revoked, nil
+}
+
+// PurgeStaleSessions は失効済み、またはリフレッシュトークンの有効期限を超えて使われていないセッションを削除する。
+func (r *SessionRepository) PurgeStaleSessions() (int64, error) {
+	threshold := time.Now().Add(-RefreshTokenTTL)
+	result := database.Db.Unscoped().
+		Where("(revoked_at IS NOT NULL AND revoked_at < ?) OR last_seen_at < ?", threshold, threshold).
+		Delete(&schema.Session{})
+	return result.RowsAffected, result.Error
+}
+
+// RevokeUserSessions は tx の中でユーザーのセッションとリフレッシュトークンを失効させる。
+// パスワード変更など、他の端末からログアウトさせたい処理から使う。
+func RevokeUserSessions(tx *gorm.DB, userID, exceptSessionID uint) (int64, error) {
+	query := tx.Where("user_id = ?", userID)
+	if exceptSessionID != 0 {
+		query = query.Where("id <> ?", exceptSessionID)
+	}
+	revoked, err := revokeSessions(query)
+	if err != nil {
+		return 0, err
+	}
+
+	refreshTokens := tx.Model(&schema.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if exceptSessionID != 0 {
+		refreshTokens = refreshTokens.Where("session_id <> ?", exceptSessionID)
+	}
+	if err := refreshTokens.Update("revoked_at", time.Now()).Error; err != nil {
+		return 0, err
+	}
+	return revoked, nil
+}
+
+// revokeSessions は query に該当する有効なセッションと、それに紐づくリフレッシュトークンを失効させる。
+func revokeSessions(query *gorm.DB) (int64, error) {
+	var sessionIDs []uint
+	if err := query.Model(&schema.Session{}).Where("revoked_at IS NULL").Pluck("id", &sessionIDs).Error; err != nil {
+		return 0, err
+	}
+	if len(sessionIDs) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	db := query.Session(&gorm.Session{NewDB: true})
+	if err := db.Model(&schema.Session{}).Where("id IN ?", sessionIDs).Update("revoked_at", now).Error; err != nil {
+		return 0, err
+	}
+	if err := db.Model(&schema.RefreshToken{}).
+		Where("session_id IN ? AND revoked_at IS NULL", sessionIDs).
+		Update("revoked_at", now).Error; err != nil {
+		return 0, err
+	}
+	return int64(len(sessionIDs)), nil
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{"short", "Mozilla/5.0", "Mozilla/5.0"},
+		{"ascii", strings.Repeat("a", 600), strings.Repeat("a", maxUserAgentLength)},
+		// バイト数で切るとマルチバイト文字の途中で切れる長さ
+		{"multibyte", "a" + strings.Repeat("端末", 300), "a" + strings.Repeat("端末", 255) + "端"},
+		{"invalid utf-8", "Mozilla/5.0 \xff\xfe(X11)", "Mozilla/5.0 (X11)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateUserAgent(tt.userAgent); got != tt.want {
+				t.Errorf("got %q (%d 文字), want %q", got, utf8.RuneCountInString(got), tt.want)
+			}
+		})
+	}
+}
+
+// 長い日本語の User-Agent でもセッションと監査ログを保存できる
+func TestLongNonASCIIUserAgentIsStored(t *testing.T) {
+	db, recorder := newDryRunDB(t)
+	previous := database.Db
+	database.Db = db
+	t.Cleanup(func() { database.Db = previous })
+
+	userAgent := "Mozilla/5.0 (ブラウザ) " + strings.Repeat("日本語の端末名", 100)
+
+	session, err := NewSessionRepository().CreateSession(1, userAgent, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if !utf8.ValidString(session.UserAgent) || utf8.RuneCountInString(session.UserAgent) != maxUserAgentLength {
+		t.Errorf("session user agent: %d 文字, valid UTF-8 = %v", utf8.RuneCountInString(session.UserAgent), utf8.ValidString(session.UserAgent))
+	}
+
+	if err := NewAuditRepository().Record(schema.AuditEvent{Action: "test", UserAgent: userAgent}, nil); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if !recorder.contains("INSERT INTO \"audit_events\"", "Mozilla/5.0 (ブラウザ)") {
+		t.Errorf("監査ログを保存していません: %q", recorder.statements)
+	}
+	for _, sql := range recorder.statements {
+		if !utf8.ValidString(sql) {
+			t.Errorf("不正な UTF-8 を保存しようとしています: %q", sql)
+		}
+	}
+}
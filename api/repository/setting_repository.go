@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"errors"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 設定キー
+const (
+	// カンマ区切りのロール。該当ロールの権限は二要素認証を有効にしたユーザーにだけ与える
+	SettingTwoFactorRequiredRoles = "two_factor_required_roles"
+	// "false" の場合は招待コードなしで登録できる。未設定の場合は招待制
+	SettingRegistrationInviteRequired = "registration_invite_required"
+	// カンマ区切りのドメイン。空の場合はドメインを制限しない
+	SettingRegistrationAllowedDomains = "registration_allowed_domains"
+)
+
+type SettingRepository struct{}
+
+func NewSettingRepository() *SettingRepository {
+	return &SettingRepository{}
+}
+
+// GetSetting は key の値を返す。未設定の場合は空文字と false を返す。
+func (r *SettingRepository) GetSetting(key string) (string, bool, error) {
+	var setting schema.Setting
+	err := database.Db.Where("key = ?", key).First(&setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return setting.Value, true, nil
+}
+
+func (r *SettingRepository) SetSetting(key, value string) error {
+	return database.Db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&schema.Setting{Key: key, Value: value}).Error
+}
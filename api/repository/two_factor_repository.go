@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sayasurvey/golang/api/jwtkey"
+	"github.com/sayasurvey/golang/api/totp"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	TwoFactorChallengeTTL = time.Minute * 5
+	RecoveryCodeCount     = 10
+)
+
+const twoFactorChallengePurpose = "2fa_challenge"
+
+var (
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorCodeInvalid    = errors.New("two-factor code is invalid")
+	ErrTwoFactorChallenge      = errors.New("two-factor challenge is invalid")
+)
+
+type TwoFactorRepository struct{}
+
+func NewTwoFactorRepository() *TwoFactorRepository {
+	return &TwoFactorRepository{}
+}
+
+func (r *TwoFactorRepository) IsEnabled(userID uint) (bool, error) {
+	var count int64
+	err := database.Db.Model(&schema.TwoFactor{}).Where("user_id = ? AND enabled_at IS NOT NULL", userID).Count(&count).Error
+	return count > 0, err
+}
+
+// BeginEnrollment は新しい秘密鍵を発行して登録途中の状態にする。
+// 既に有効化済みの場合は ErrTwoFactorAlreadyEnabled を返す。
+func (r *TwoFactorRepository) BeginEnrollment(userID uint) (string, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+
+	var twoFactor schema.TwoFactor
+	err = database.Db.Where("user_id = ?", userID).First(&twoFactor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		twoFactor = schema.TwoFactor{UserID: userID, Secret: secret}
+		return secret, database.Db.Create(&twoFactor).Error
+	}
+	if err != nil {
+		return "", err
+	}
+	if twoFactor.EnabledAt != nil {
+		return "", ErrTwoFactorAlreadyEnabled
+	}
+
+	return secret, database.Db.Model(&twoFactor).Updates(map[string]interface{}{"secret": secret, "last_used_step": 0}).Error
+}
+
+// Enable は登録途中の秘密鍵に対するコードを確認して二要素認証を有効にし、リカバリーコードを返す。
+// 有効化前にログインした他の端末のセッションは失効させる。
+func (r *TwoFactorRepository) Enable(userID, currentSessionID uint, code string) ([]string, error) {
+	var twoFactor schema.TwoFactor
+	if err := database.Db.Where("user_id = ?", userID).First(&twoFactor).Error; err != nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if twoFactor.EnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(twoFactor.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrTwoFactorCodeInvalid
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := database.Db.Begin()
+
+	if err := tx.Model(&twoFactor).Updates(map[string]interface{}{"enabled_at": time.Now(), "last_used_step": step}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, hashes); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if _, err := RevokeUserSessions(tx, userID, currentSessionID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (r *TwoFactorRepository) Disable(userID uint) error {
+	tx := database.Db.Begin()
+
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&schema.TwoFactor{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&schema.RecoveryCode{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Verify は TOTP コードまたはリカバリーコードを検証する。
+// TOTP は一度使ったタイムステップ以前のコードを拒否し、リカバリーコードは使用済みにする。
+func (r *TwoFactorRepository) Verify(userID uint, code string) error {
+	var twoFactor schema.TwoFactor
+	if err := database.Db.Where("user_id = ? AND enabled_at IS NOT NULL", userID).First(&twoFactor).Error; err != nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := totp.Validate(twoFactor.Secret, code, time.Now()); ok {
+		result := database.Db.Model(&schema.TwoFactor{}).
+			Where("id = ? AND last_used_step < ?", twoFactor.ID, step).
+			Update("last_used_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTwoFactorCodeInvalid
+		}
+		return nil
+	}
+
+	result := database.Db.Model(&schema.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorCodeInvalid
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes は未使用のリカバリーコードを全て破棄して作り直す。
+func (r *TwoFactorRepository) RegenerateRecoveryCodes(userID uint) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := database.Db.Begin()
+	if err := replaceRecoveryCodes(tx, userID, hashes); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RequiredRoles は二要素認証が必須のロールを返す。
+func (r *TwoFactorRepository) RequiredRoles() ([]schema.Role, error) {
+	value, _, err := NewSettingRepository().GetSetting(SettingTwoFactorRequiredRoles)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []schema.Role
+	for _, role := range strings.Split(value, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, schema.Role(role))
+		}
+	}
+	return roles, nil
+}
+
+func (r *TwoFactorRepository) SetRequiredRoles(roles []schema.Role) error {
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = string(role)
+	}
+	return NewSettingRepository().SetSetting(SettingTwoFactorRequiredRoles, strings.Join(names, ","))
+}
+
+// GenerateChallengeToken はパスワード確認後、二要素認証のコード入力待ちであることを示す短命なトークンを返す。
+func (r *TwoFactorRepository) GenerateChallengeToken(user *schema.User) (string, error) {
+	return jwtkey.Current().Sign(jwt.MapClaims{
+		"purpose": twoFactorChallengePurpose,
+		"user_id": user.ID,
+		"exp":     time.Now().Add(TwoFactorChallengeTTL).Unix(),
+	})
+}
+
+// ParseChallengeToken はチャレンジトークンを検証してユーザーを返す。
+func (r *TwoFactorRepository) ParseChallengeToken(tokenString string) (*schema.User, error) {
+	token, err := jwtkey.Current().Parse(tokenString)
+	if err != nil || !token.Valid {
+		return nil, ErrTwoFactorChallenge
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != twoFactorChallengePurpose {
+		return nil, ErrTwoFactorChallenge
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, ErrTwoFactorChallenge
+	}
+
+	var user schema.User
+	if err := database.Db.First(&user, uint(userID)).Error; err != nil {
+		return nil, ErrTwoFactorChallenge
+	}
+	return &user, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, hashes []string) error {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&schema.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+
+	recoveryCodes := make([]schema.RecoveryCode, len(hashes))
+	for i, hash := range hashes {
+		recoveryCodes[i] = schema.RecoveryCode{UserID: userID, CodeHash: hash}
+	}
+	return tx.Create(&recoveryCodes).Error
+}
+
+// generateRecoveryCodes は xxxxx-xxxxx 形式のリカバリーコードとそのハッシュを返す。
+func generateRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashToken(raw)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"errors"
+	"github.com/sayasurvey/golang/api/pagination"
+	"github.com/sayasurvey/golang/model/database"
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// UserStatus は管理画面で絞り込むアカウントの状態。
+type UserStatus string
+
+const (
+	UserStatusActive    UserStatus = "active"
+	UserStatusSuspended UserStatus = "suspended"
+)
+
+var ErrLastAdmin = errors.New("cannot remove the last active admin")
+
+// UserSearch はユーザー検索の条件。Query は名前とメールアドレスの部分一致。
+type UserSearch struct {
+	Query  string
+	Role   schema.Role
+	Status UserStatus
+}
+
+type UserRepository struct{}
+
+func NewUserRepository() *UserRepository {
+	return &UserRepository{}
+}
+
+// SearchUsers は条件に合うユーザーを主キー順に1ページ分返す。
+func (r *UserRepository) SearchUsers(search UserSearch, params pagination.Params) ([]schema.User, pagination.Result, error) {
+	query := database.Db.Model(&schema.User{})
+	q := strings.TrimSpace(search.Query)
+	if q != "" {
+		pattern := "%" + escapeLike(strings.ToLower(q)) + "%"
+		query = query.Where("LOWER(name) LIKE ? OR LOWER(email) LIKE ?", pattern, pattern)
+	}
+	if search.Role != "" {
+		query = query.Where("role = ?", search.Role)
+	}
+	switch search.Status {
+	case UserStatusActive:
+		query = query.Where("suspended_at IS NULL")
+	case UserStatusSuspended:
+		query = query.Where("suspended_at IS NOT NULL")
+	}
+
+	order := pagination.OrderKey("users", strings.ToLower(q), string(search.Role), string(search.Status))
+	return pagination.ByID(query, params, order, "id", func(user schema.User) uint { return user.ID })
+}
+
+// DirectoryEntry はユーザー一覧に表示する公開プロフィール。
+type DirectoryEntry struct {
+	ID           uint
+	Name         string
+	AvatarURL    string
+	Email        string
+	EmailVisible bool
+	BookCount    int64
+}
+
+// SearchDirectory は停止中でないユーザーの公開プロフィールを名前の部分一致で検索し、名前順に1ページ分返す。
+// 次のページは名前と主キーのキーセット方式のカーソルで表す。
+func (r *UserRepository) SearchDirectory(name string, params pagination.Params) ([]DirectoryEntry, pagination.Result, error) {
+	var entries []DirectoryEntry
+	var result pagination.Result
+	name = strings.TrimSpace(name)
+	order := pagination.OrderKey("directory", strings.ToLower(name))
+	if err := params.Check(order, true); err != nil {
+		return nil, result, err
+	}
+
+	query := database.Db.Model(&schema.User{}).Where("users.suspended_at IS NULL")
+	if name != "" {
+		query = query.Where("LOWER(users.name) LIKE ?", "%"+escapeLike(strings.ToLower(name))+"%")
+	}
+
+	// 件数の取得とページの取得で同じ条件を使い回す
+	query = query.Session(&gorm.Session{})
+
+	if params.WithTotal {
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return nil, result, err
+		}
+		result.Total = &total
+	}
+
+	query = query.
+		Select("users.id, users.name, users.avatar_url, users.email, users.email_visible, " +
+			"(SELECT COUNT(*) FROM books WHERE books.user_id = users.id AND books.deleted_at IS NULL) AS book_count").
+		Order("users.name, users.id")
+	// カーソルがなければ Keyset は何もしないが、Cursor.Value を読むために確かめる
+	if params.Cursor != nil {
+		query = params.Keyset(query, "users.name", params.Cursor.Value, "users.id", false)
+	}
+	if err := params.Limit(query).Scan(&entries).Error; err != nil {
+		return nil, result, err
+	}
+
+	entries, hasNext := pagination.Trim(entries, params.PerPage)
+	if hasNext {
+		last := entries[len(entries)-1]
+		result.Next = &pagination.Cursor{Value: last.Name, ID: last.ID, Order: order}
+	}
+	return entries, result, nil
+}
+
+// IsActive はユーザーが存在し、停止されていないかを返す。退会済みのユーザーは存在しない扱いになる。
+func (r *UserRepository) IsActive(userID uint) (bool, error) {
+	var count int64
+	err := database.Db.Model(&schema.User{}).Where("id = ? AND suspended_at IS NULL", userID).Count(&count).Error
+	return count > 0, err
+}
+
+// UpdateRole はロールを変更し、古いロールを持つアクセストークンが使われないようセッションを失効させる。
+// 有効な管理者が1人もいなくなる変更は ErrLastAdmin を返す。
+func (r *UserRepository) UpdateRole(userID uint, role schema.Role) error {
+	tx := database.Db.Begin()
+
+	var user schema.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if user.Role == role {
+		tx.Rollback()
+		return nil
+	}
+
+	if user.Role == schema.AdminRole && user.SuspendedAt == nil {
+		if err := ensureAnotherAdmin(tx, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Model(&user).Update("role", role).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := RevokeUserSessions(tx, userID, 0); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Suspend はアカウントを停止し、全てのセッションを失効させる。
+// API キーは残すが、停止中は認証ミドルウェアで拒否される。
+func (r *UserRepository) Suspend(userID uint, reason string) error {
+	tx := database.Db.Begin()
+
+	var user schema.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if user.Role == schema.AdminRole && user.SuspendedAt == nil {
+		if err := ensureAnotherAdmin(tx, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Model(&user).Updates(map[string]interface{}{
+		"suspended_at":      time.Now(),
+		"suspension_reason": reason,
+	}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := RevokeUserSessions(tx, userID, 0); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func (r *UserRepository) Reactivate(userID uint) error {
+	result := database.Db.Model(&schema.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"suspended_at":      nil,
+		"suspension_reason": "",
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ForcePasswordReset は現在のパスワードを使えなくし、全てのセッションと API キーを失効させる。
+// 利用者は再設定メールのリンクから新しいパスワードを設定する。
+func (r *UserRepository) ForcePasswordReset(userID uint) error {
+	tx := database.Db.Begin()
+
+	result := tx.Model(&schema.User{}).Where("id = ?", userID).Update("password", "")
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return gorm.ErrRecordNotFound
+	}
+
+	if _, err := RevokeUserSessions(tx, userID, 0); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := RevokeUserAPIKeys(tx, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func ensureAnotherAdmin(tx *gorm.DB, userID uint) error {
+	var admins int64
+	err := tx.Model(&schema.User{}).
+		Where("role = ? AND suspended_at IS NULL AND id <> ?", schema.AdminRole, userID).
+		Count(&admins).Error
+	if err != nil {
+		return err
+	}
+	if admins == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
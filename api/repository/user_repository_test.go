@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"errors"
+	"github.com/sayasurvey/golang/api/pagination"
+	"testing"
+)
+
+// 検索条件の違う一覧のカーソルはデータベースに問い合わせる前に拒否する
+func TestSearchDirectoryRejectsCursorOfOtherQuery(t *testing.T) {
+	cursor := &pagination.Cursor{Value: "佐藤", ID: 7, Order: pagination.OrderKey("directory", "佐")}
+
+	params := pagination.Params{PerPage: pagination.DefaultPerPage, Cursor: cursor}
+	if _, _, err := new(UserRepository).SearchDirectory("鈴", params); !errors.Is(err, pagination.ErrInvalidCursor) {
+		t.Errorf("got %v, want %v", err, pagination.ErrInvalidCursor)
+	}
+}
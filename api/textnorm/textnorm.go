@@ -0,0 +1,49 @@
+package textnorm
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+// Normalize は検索用に文字列の表記ゆれを揃える。
+//
+//   - NFKC で全角英数字・記号を半角に、半角カナを全角に揃える
+//   - カタカナをひらがなに揃える
+//   - 英字を小文字に揃える
+//   - 連続する空白を1つにまとめる
+//
+// 検索対象のテキストと検索語の両方に同じ正規化をかけて比較する。
+func Normalize(s string) string {
+	s = norm.NFKC.String(s)
+
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteRune(' ')
+			space = false
+		}
+		b.WriteRune(toHiragana(unicode.ToLower(r)))
+	}
+	return b.String()
+}
+
+// Terms は Normalize した文字列を空白で区切った検索語を返す。
+func Terms(s string) []string {
+	return strings.Fields(Normalize(s))
+}
+
+// toHiragana はァ（U+30A1）〜ヶ（U+30F6）をひらがなに変換する。
+// ヷ〜ヺ などひらがなに対応する文字がないものはそのまま返す。
+func toHiragana(r rune) rune {
+	if r >= 'ァ' && r <= 'ヶ' {
+		return r - ('ァ' - 'ぁ')
+	}
+	return r
+}
@@ -0,0 +1,73 @@
+package textnorm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"full-width alphanumerics", "ＧＯ言語１２３", "go言語123"},
+		{"upper case", "The Go Programming Language", "the go programming language"},
+		{"katakana", "コンピュータ", "こんぴゅーた"},
+		{"half-width katakana", "ｺﾝﾋﾟｭｰﾀ", "こんぴゅーた"},
+		{"half-width voiced mark", "ｶﾞｲﾄﾞ", "がいど"},
+		{"vu", "ヴァイオリン", "ゔぁいおりん"},
+		{"small ke", "ヶ月", "ゖ月"},
+		{"katakana without hiragana", "ヷ", "ヷ"},
+		{"full-width symbols", "Ｃ＋＋（入門）", "c++(入門)"},
+		{"spaces", "　吾輩は \t 猫である　", "吾輩は 猫である"},
+		{"kanji", "羅生門", "羅生門"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.input); got != tt.want {
+				t.Errorf("Normalize(%q): got %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", []string{}},
+		{"　 ", []string{}},
+		{"Go　ﾌﾟﾛｸﾞﾗﾐﾝｸﾞ 入門", []string{"go", "ぷろぐらみんぐ", "入門"}},
+	}
+
+	for _, tt := range tests {
+		if got := Terms(tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Terms(%q): got %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// 検索対象のテキストと検索語は同じ正規化で比べるため、表記ゆれのある検索語でも一致する
+func TestTermsMatchNormalizedText(t *testing.T) {
+	tests := []struct {
+		text  string
+		query string
+	}{
+		{"プログラミング言語Go", "ぷろぐらみんぐ ｇｏ"},
+		{"ＳＱＬアンチパターン", "sql ｱﾝﾁﾊﾟﾀｰﾝ"},
+		{"はじめてのPython", "ハジメテ PYTHON"},
+	}
+
+	for _, tt := range tests {
+		text := Normalize(tt.text)
+		for _, term := range Terms(tt.query) {
+			if !strings.Contains(text, term) {
+				t.Errorf("%q に %q の検索語 %q が含まれていません", text, tt.query, term)
+			}
+		}
+	}
+}
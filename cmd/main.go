@@ -1,14 +1,95 @@
 package main
 
 import (
+	"github.com/sayasurvey/golang/api/jwtkey"
+	"github.com/sayasurvey/golang/api/mailer"
+	"github.com/sayasurvey/golang/api/passwordpolicy"
+	"github.com/sayasurvey/golang/api/repository"
 	"github.com/sayasurvey/golang/model/database"
 	"github.com/sayasurvey/golang/router"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// purgeExpiredTokens は有効期限を過ぎた各種トークンを定期的に削除する。
+func purgeExpiredTokens(interval time.Duration) {
+	authRepo := repository.NewAuthRepository()
+	refreshTokenRepo := repository.NewRefreshTokenRepository()
+	passwordResetRepo := repository.NewPasswordResetRepository()
+	loginAttemptStore := repository.NewDBLoginAttemptStore()
+	oidcRepo := repository.NewOIDCRepository()
+	sessionRepo := repository.NewSessionRepository()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := authRepo.PurgeExpiredTokens(); err != nil {
+			fmt.Println("失効トークンの削除に失敗しました:", err)
+		}
+		if _, err := refreshTokenRepo.PurgeExpiredRefreshTokens(); err != nil {
+			fmt.Println("期限切れリフレッシュトークンの削除に失敗しました:", err)
+		}
+		if _, err := passwordResetRepo.PurgeExpiredResetTokens(); err != nil {
+			fmt.Println("期限切れパスワード再設定トークンの削除に失敗しました:", err)
+		}
+		if _, err := loginAttemptStore.PurgeStaleAttempts(time.Hour * 24); err != nil {
+			fmt.Println("古いログイン失敗記録の削除に失敗しました:", err)
+		}
+		if _, err := oidcRepo.PurgeExpiredAuthRequests(); err != nil {
+			fmt.Println("期限切れ OIDC 認可リクエストの削除に失敗しました:", err)
+		}
+		if _, err := sessionRepo.PurgeStaleSessions(); err != nil {
+			fmt.Println("古いセッションの削除に失敗しました:", err)
+		}
+		if _, err := repository.PurgeExpiredBookMetadataCache(); err != nil {
+			fmt.Println("期限切れ書誌情報キャッシュの削除に失敗しました:", err)
+		}
+	}
+}
+
+// reloadKeysOnSignal は SIGHUP を受けたら鍵ディレクトリを再読み込みする。
+// 鍵の追加や署名鍵の切り替えを再起動なしで反映するため。
+func reloadKeysOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		if err := jwtkey.Init(); err != nil {
+			fmt.Println("署名鍵の再読み込みに失敗しました:", err)
+			continue
+		}
+		fmt.Println("署名鍵を再読み込みしました")
+	}
+}
+
 func main() {
 	database.DbInit()
 
+	if _, err := repository.BackfillBookSearchText(); err != nil {
+		fmt.Println("本の検索用テキストの設定に失敗しました:", err)
+	}
+
+	if err := jwtkey.Init(); err != nil {
+		fmt.Println("署名鍵の読み込みに失敗しました", err)
+		panic("failed to load signing keys")
+	}
+	go reloadKeysOnSignal()
+
+	if err := passwordpolicy.Init(); err != nil {
+		fmt.Println("パスワードポリシーの読み込みに失敗しました", err)
+		panic("failed to load password policy")
+	}
+
+	if err := mailer.Init(); err != nil {
+		fmt.Println("メール送信の設定に失敗しました", err)
+		panic("failed to configure mailer")
+	}
+
+	go purgeExpiredTokens(time.Hour)
+
 	router := router.GetRouter()
 	port := os.Getenv("PORT")
 	if port == "" {
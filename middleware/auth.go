@@ -5,32 +5,60 @@ import (
 	"strings"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
-	"os"
+	"github.com/sayasurvey/golang/api/authcookie"
+	"github.com/sayasurvey/golang/api/jwtkey"
+	"github.com/sayasurvey/golang/api/repository"
 )
 
+// c.Get("auth_method") の値
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+)
+
+var authRepo = repository.NewAuthRepository()
+var apiKeyRepo = repository.NewAPIKeyRepository()
+var sessionRepo = repository.NewSessionRepository()
+var userRepo = repository.NewUserRepository()
+
 func JWTAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "認証が必要です"})
-			c.Abort()
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			authenticateAPIKey(c, apiKey)
 			return
 		}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "無効な認証形式です"})
-			c.Abort()
-			return
-		}
+		var tokenString string
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			// クッキー認証ではブラウザが自動でクッキーを送るため、変更系のリクエストは CSRF トークンを確認する
+			tokenString = authcookie.Token(c, authcookie.AccessTokenCookie)
+			if tokenString == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "認証が必要です"})
+				c.Abort()
+				return
+			}
+			if !authcookie.VerifyCSRF(c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "CSRF トークンが不正です"})
+				c.Abort()
+				return
+			}
+		} else {
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "無効な認証形式です"})
+				c.Abort()
+				return
+			}
 
-		tokenString := parts[1]
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
+			tokenString = parts[1]
+			if repository.IsAPIKey(tokenString) {
+				authenticateAPIKey(c, tokenString)
+				return
 			}
-			return []byte(os.Getenv("SECRET_KEY")), nil
-		})
+		}
+
+		token, err := jwtkey.Current().Parse(tokenString)
 
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "無効なトークンです"})
@@ -39,7 +67,65 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 		}
 
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			c.Set("user_id", uint(claims["user_id"].(float64)))
+			// メール確認用など用途付きのトークンはアクセストークンとして受け付けない
+			if _, hasPurpose := claims["purpose"]; hasPurpose {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "無効なトークンです"})
+				c.Abort()
+				return
+			}
+
+			// jti を持たない旧形式のトークンはトークン文字列そのものを失効キーにする
+			tokenID, _ := claims["jti"].(string)
+			if tokenID == "" {
+				tokenID = tokenString
+			}
+
+			invalidated, err := authRepo.IsTokenInvalidated(tokenID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "トークンの検証に失敗しました"})
+				c.Abort()
+				return
+			}
+			if invalidated {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "無効なトークンです"})
+				c.Abort()
+				return
+			}
+
+			expiresAt, err := claims.GetExpirationTime()
+			if err != nil || expiresAt == nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "無効なトークンです"})
+				c.Abort()
+				return
+			}
+
+			// sid を持つトークンは、セッションが失効していれば拒否する
+			var sessionID uint
+			if sid, ok := claims["sid"].(float64); ok && sid > 0 {
+				sessionID = uint(sid)
+				active, err := sessionRepo.Touch(sessionID, c.ClientIP())
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "トークンの検証に失敗しました"})
+					c.Abort()
+					return
+				}
+				if !active {
+					c.JSON(http.StatusUnauthorized, gin.H{"error": "セッションが無効です。再度ログインしてください"})
+					c.Abort()
+					return
+				}
+			}
+
+			userID := uint(claims["user_id"].(float64))
+			if !requireActiveUser(c, userID) {
+				return
+			}
+
+			c.Set("auth_method", AuthMethodJWT)
+			c.Set("token_id", tokenID)
+			c.Set("session_id", sessionID)
+			c.Set("token_expires_at", expiresAt.Time)
+			c.Set("user_id", userID)
 			c.Set("email", claims["email"].(string))
 			c.Set("role", claims["role"].(string))
 			c.Next()
@@ -50,3 +136,42 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 		}
 	}
 }
+
+// authenticateAPIKey は Bearer JWT の代わりに渡された API キーを検証する。
+// 利用できるルートは Policy.Scope で制限される。
+func authenticateAPIKey(c *gin.Context, key string) {
+	apiKey, user, err := apiKeyRepo.Authenticate(key)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "無効な API キーです"})
+		c.Abort()
+		return
+	}
+
+	if !requireActiveUser(c, user.ID) {
+		return
+	}
+
+	c.Set("auth_method", AuthMethodAPIKey)
+	c.Set("api_key_id", apiKey.ID)
+	c.Set("api_key_scopes", repository.ParseAPIKeyScopes(apiKey.Scopes))
+	c.Set("user_id", user.ID)
+	c.Set("email", user.Email)
+	c.Set("role", string(user.Role))
+	c.Next()
+}
+
+// requireActiveUser は停止中または退会済みのユーザーを拒否する。拒否した場合は false を返す。
+func requireActiveUser(c *gin.Context, userID uint) bool {
+	active, err := userRepo.IsActive(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "トークンの検証に失敗しました"})
+		c.Abort()
+		return false
+	}
+	if !active {
+		c.JSON(http.StatusForbidden, gin.H{"error": "このアカウントは利用停止中です"})
+		c.Abort()
+		return false
+	}
+	return true
+}
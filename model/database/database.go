@@ -35,6 +35,51 @@ func DbInit() {
 		panic("failed to connect to database")
 	}
 
-	Db.AutoMigrate(&schema.User{}, &schema.Book{}, &schema.BorrowedBook{}, &schema.BorrowingWishList{}, &schema.InvalidatedToken{})
+	// verified_at 追加前から存在するユーザーは確認済みとして扱う
+	backfillVerifiedAt := Db.Migrator().HasTable(&schema.User{}) && !Db.Migrator().HasColumn(&schema.User{}, "VerifiedAt")
+
+	Db.AutoMigrate(&schema.User{}, &schema.Book{}, &schema.Author{}, &schema.BookAuthor{}, &schema.Tag{}, &schema.BookTag{}, &schema.BookMetadataCache{}, &schema.BorrowedBook{}, &schema.BorrowingWishList{}, &schema.InvalidatedToken{}, &schema.RefreshToken{}, &schema.PasswordResetToken{}, &schema.LoginAttempt{}, &schema.OIDCAuthRequest{}, &schema.UserIdentity{}, &schema.APIKey{}, &schema.TwoFactor{}, &schema.RecoveryCode{}, &schema.Setting{}, &schema.Session{}, &schema.Invite{}, &schema.AuditEvent{})
+	protectAuditEvents()
+	if err := createBookSearchIndexes(); err != nil {
+		fmt.Println("book search index creation faild", err)
+		panic("failed to create book search indexes")
+	}
+	if backfillVerifiedAt {
+		Db.Model(&schema.User{}).Where("verified_at IS NULL").Update("verified_at", gorm.Expr("created_at"))
+	}
 	fmt.Println("gorm db connect")
 }
+
+// protectAuditEvents は audit_events の更新と削除をデータベース側で禁止する。
+// 退会したユーザーの IP アドレスと User-Agent を空にする更新（repository.DeleteAccount）だけは許可する。
+func protectAuditEvents() {
+	Db.Exec(`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'UPDATE' AND NEW.ip = '' AND NEW.user_agent = ''
+		AND (NEW.id, NEW.created_at, NEW.actor_id, NEW.action, NEW.target_type, NEW.target_id, NEW.metadata)
+			IS NOT DISTINCT FROM (OLD.id, OLD.created_at, OLD.actor_id, OLD.action, OLD.target_type, OLD.target_id, OLD.metadata) THEN
+		RETURN NEW;
+	END IF;
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql`)
+	Db.Exec(`DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events`)
+	Db.Exec(`CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only()`)
+}
+
+// createBookSearchIndexes は本の検索に使う pg_trgm のインデックスを作成する。
+// 部分一致（LIKE '%語%'）の検索と word_similarity による並び替えに使うため、作成できなければ起動しない。
+func createBookSearchIndexes() error {
+	statements := []string{
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`CREATE INDEX IF NOT EXISTS idx_books_search_title_trgm ON books USING gin (search_title gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_books_search_text_trgm ON books USING gin (search_text gin_trgm_ops)`,
+	}
+	for _, statement := range statements {
+		if err := Db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
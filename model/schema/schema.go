@@ -12,12 +12,31 @@ const (
 	AdminRole Role = "ADMIN"
 )
 
+// APIKeyScope は API キーで呼び出せる操作の範囲。
+type APIKeyScope string
+
+const (
+	CatalogReadScope APIKeyScope = "catalog:read"
+	BooksWriteScope  APIKeyScope = "books:write"
+)
+
+var APIKeyScopes = []APIKeyScope{CatalogReadScope, BooksWriteScope}
+
 type User struct {
 	gorm.Model
 	Name              	string `gorm:"type:varchar(255);not null"                         validate:"required"`
 	Email             	string `gorm:"type:varchar(255);uniqueIndex;not null"             validate:"required,email"`
 	Password          	string `gorm:"type:varchar(255);not null"                         validate:"required,min=8"`
 	Role              	Role   `gorm:"type:varchar(10);default:'USER';not null" validate:"required"`
+	VerifiedAt        	*time.Time
+	// PendingEmail は確認待ちの変更後メールアドレス
+	PendingEmail      	string `gorm:"type:varchar(255);not null;default:''"`
+	// SuspendedAt が nil でないユーザーはログインも API の利用もできない
+	SuspendedAt       	*time.Time
+	SuspensionReason  	string `gorm:"type:varchar(255);not null;default:''"`
+	AvatarURL         	string `gorm:"type:varchar(255);not null;default:''"`
+	// EmailVisible が true のユーザーだけユーザー一覧にメールアドレスを表示する
+	EmailVisible      	bool   `gorm:"not null;default:false"`
 	Books 				[]Book
 	BorrowedBooks 		[]BorrowedBook
 	BorrowingWishLists 	[]BorrowingWishList
@@ -30,6 +49,58 @@ type Book struct {
 	Title  		string `gorm:"type:varchar(255);not null" validate:"required"`
 	ImageUrl  string `gorm:"type:varchar(255);not null" validate:"required"`
 	Loanable  bool   `gorm:"not null"                   validate:"required"`
+	// ISBN は ISBN-10 で登録された場合も ISBN-13 に変換して保存する
+	ISBN          string `gorm:"type:varchar(13);not null;default:'';index"`
+	Publisher     string `gorm:"type:varchar(255);not null;default:''"`
+	// PublishedDate は YYYY / YYYY-MM / YYYY-MM-DD のいずれか
+	PublishedDate string `gorm:"type:varchar(10);not null;default:''"`
+	PageCount     int    `gorm:"not null;default:0"`
+	Language      string `gorm:"type:varchar(16);not null;default:''"`
+	Description   string `gorm:"type:text;not null;default:''"`
+	BookAuthors   []BookAuthor
+	BookTags      []BookTag
+	// SearchTitle と SearchText は textnorm.Normalize で正規化した検索用の書名と、書名・著者名・説明文。
+	// 本の保存時に repository.SaveBook が設定する
+	SearchTitle   string `gorm:"type:varchar(255);not null;default:''"`
+	SearchText    string `gorm:"type:text;not null;default:''"`
+}
+
+type Author struct {
+	gorm.Model
+	Name string `gorm:"type:varchar(255);uniqueIndex;not null" validate:"required"`
+}
+
+// BookAuthor は本と著者の対応。Position は著者の表示順。
+type BookAuthor struct {
+	ID       uint `gorm:"primaryKey"`
+	BookID   uint `gorm:"not null;uniqueIndex:idx_book_author"        validate:"required"`
+	AuthorID uint `gorm:"not null;uniqueIndex:idx_book_author;index"  validate:"required"`
+	Position int  `gorm:"not null;default:0"`
+	Author   Author
+}
+
+// Tag は本の分類に使うタグ。本の所有者が自由に付ける。
+type Tag struct {
+	gorm.Model
+	Name string `gorm:"type:varchar(64);uniqueIndex;not null" validate:"required"`
+}
+
+// BookTag は本とタグの対応。
+type BookTag struct {
+	ID     uint `gorm:"primaryKey"`
+	BookID uint `gorm:"not null;uniqueIndex:idx_book_tag"        validate:"required"`
+	TagID  uint `gorm:"not null;uniqueIndex:idx_book_tag;index"  validate:"required"`
+	Tag    Tag
+}
+
+// BookMetadataCache は ISBN ごとの書誌情報の取得結果。見つからなかった ISBN も Found=false で保存する。
+type BookMetadataCache struct {
+	gorm.Model
+	ISBN      string    `gorm:"type:varchar(13);uniqueIndex;not null" validate:"required"`
+	Found     bool      `gorm:"not null"`
+	// Data は bookmeta.Metadata の JSON
+	Data      string    `gorm:"type:text;not null;default:''"`
+	ExpiresAt time.Time `gorm:"not null;index"                        validate:"required"`
 }
 
 type BorrowedBook struct {
@@ -52,6 +123,122 @@ type InvalidatedToken struct {
 	ExpiresAt time.Time `gorm:"not null" validate:"required"`
 }
 
+type RefreshToken struct {
+	gorm.Model
+	UserID    uint       `gorm:"not null;index"                      validate:"required"`
+	SessionID uint       `gorm:"not null;default:0;index"`
+	TokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null" validate:"required"`
+	FamilyID  string     `gorm:"type:varchar(32);index;not null"      validate:"required"`
+	ExpiresAt time.Time  `gorm:"not null"                             validate:"required"`
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// Session はログイン1回分。アクセストークンの sid クレームとリフレッシュトークンが参照する。
+type Session struct {
+	gorm.Model
+	UserID     uint      `gorm:"not null;index"             validate:"required"`
+	UserAgent  string    `gorm:"type:varchar(512);not null"`
+	IP         string    `gorm:"type:varchar(64);not null"`
+	LastSeenAt time.Time `gorm:"not null"`
+	RevokedAt  *time.Time
+}
+
+type PasswordResetToken struct {
+	gorm.Model
+	UserID    uint      `gorm:"not null;index"                        validate:"required"`
+	TokenHash string    `gorm:"type:varchar(64);uniqueIndex;not null" validate:"required"`
+	ExpiresAt time.Time `gorm:"not null"                              validate:"required"`
+	UsedAt    *time.Time
+}
+
+type LoginAttempt struct {
+	gorm.Model
+	Key          string    `gorm:"type:varchar(255);uniqueIndex;not null" validate:"required"`
+	Failures     int       `gorm:"not null;default:0"`
+	LastFailedAt time.Time `gorm:"not null"`
+	BlockedUntil time.Time `gorm:"not null"`
+}
+
+type OIDCAuthRequest struct {
+	gorm.Model
+	State        string    `gorm:"type:varchar(64);uniqueIndex;not null" validate:"required"`
+	Nonce        string    `gorm:"type:varchar(64);not null"             validate:"required"`
+	CodeVerifier string    `gorm:"type:varchar(128);not null"            validate:"required"`
+	ExpiresAt    time.Time `gorm:"not null"                              validate:"required"`
+}
+
+type UserIdentity struct {
+	gorm.Model
+	UserID  uint   `gorm:"not null;index"                                       validate:"required"`
+	Issuer  string `gorm:"type:varchar(255);not null;uniqueIndex:idx_issuer_subject" validate:"required"`
+	Subject string `gorm:"type:varchar(255);not null;uniqueIndex:idx_issuer_subject" validate:"required"`
+}
+
+type APIKey struct {
+	gorm.Model
+	UserID     uint       `gorm:"not null;index"                        validate:"required"`
+	Name       string     `gorm:"type:varchar(255);not null"            validate:"required"`
+	Prefix     string     `gorm:"type:varchar(16);not null"             validate:"required"`
+	KeyHash    string     `gorm:"type:varchar(64);uniqueIndex;not null" validate:"required"`
+	// Scopes はカンマ区切りの APIKeyScope
+	Scopes     string     `gorm:"type:varchar(255);not null"            validate:"required"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+type TwoFactor struct {
+	gorm.Model
+	UserID     uint       `gorm:"not null;uniqueIndex"        validate:"required"`
+	Secret     string     `gorm:"type:varchar(64);not null"   validate:"required"`
+	// EnabledAt が nil の間は登録途中（コード未確認）
+	EnabledAt  *time.Time
+	// LastUsedStep は最後に受け付けたタイムステップ。同じコードの再利用を防ぐ
+	LastUsedStep int64    `gorm:"not null;default:0"`
+}
+
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint      `gorm:"not null;index"                         validate:"required"`
+	CodeHash string    `gorm:"type:varchar(64);not null;index"        validate:"required"`
+	UsedAt   *time.Time
+}
+
+// Invite は管理者が発行する招待コード。コードはハッシュだけを保存する。
+type Invite struct {
+	gorm.Model
+	CreatedByID uint       `gorm:"not null;index"                        validate:"required"`
+	Prefix      string     `gorm:"type:varchar(16);not null"             validate:"required"`
+	CodeHash    string     `gorm:"type:varchar(64);uniqueIndex;not null" validate:"required"`
+	Note        string     `gorm:"type:varchar(255);not null;default:''"`
+	MaxUses     int        `gorm:"not null;default:1"                    validate:"required"`
+	UseCount    int        `gorm:"not null;default:0"`
+	ExpiresAt   *time.Time
+	RevokedAt   *time.Time
+}
+
+type Setting struct {
+	gorm.Model
+	Key   string `gorm:"type:varchar(255);uniqueIndex;not null" validate:"required"`
+	Value string `gorm:"type:text;not null"`
+}
+
+// AuditEvent は監査ログ1件。追記専用のため gorm.Model（更新日時・論理削除）は使わない。
+type AuditEvent struct {
+	ID         uint      `gorm:"primaryKey"`
+	CreatedAt  time.Time `gorm:"not null;index"`
+	// ActorID は操作したユーザー。ログイン失敗など本人が特定できない場合は nil
+	ActorID    *uint     `gorm:"index"`
+	Action     string    `gorm:"type:varchar(64);not null;index" validate:"required"`
+	TargetType string    `gorm:"type:varchar(32);not null;default:''"`
+	TargetID   *uint
+	IP         string    `gorm:"type:varchar(64);not null;default:''"`
+	UserAgent  string    `gorm:"type:varchar(512);not null;default:''"`
+	// Metadata は操作ごとの補足情報（JSON）
+	Metadata   string    `gorm:"type:text;not null;default:'{}'"`
+}
+
 type LoginRequest struct {
 	Email    string 		`json:"email"    validate:"required"`
 	Password string 		`json:"password" validate:"required"`
@@ -0,0 +1,315 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sayasurvey/golang/middleware"
+	"github.com/sayasurvey/golang/model/schema"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// access はルートを呼び出せる利用者の範囲。routePolicies とは別に書き、設定の誤りを検出する。
+type access int
+
+const (
+	authenticated access = iota
+	adminOnlyAccess
+	ownerOrAdminAccess
+)
+
+var expectedAccess = map[string]access{
+	"POST /api/logout":                     authenticated,
+	"GET /api/users":                       adminOnlyAccess,
+	"GET /api/users/:id":                   adminOnlyAccess,
+	"PUT /api/users/:id/role":              adminOnlyAccess,
+	"POST /api/users/:id/suspend":          adminOnlyAccess,
+	"POST /api/users/:id/reactivate":       adminOnlyAccess,
+	"POST /api/users/:id/password-reset":   adminOnlyAccess,
+	"POST /api/users/:id/unlock":           adminOnlyAccess,
+	"DELETE /api/users/:id":                adminOnlyAccess,
+	"GET /api/directory":                   authenticated,
+	"GET /api/me":                          authenticated,
+	"PATCH /api/me":                        authenticated,
+	"DELETE /api/me":                       authenticated,
+	"POST /api/me/password":                authenticated,
+	"GET /api/me/api-keys":                 authenticated,
+	"POST /api/me/api-keys":                authenticated,
+	"DELETE /api/me/api-keys/:id":          authenticated,
+	"GET /api/me/sessions":                 authenticated,
+	"DELETE /api/me/sessions":              authenticated,
+	"DELETE /api/me/sessions/:id":          authenticated,
+	"POST /api/me/2fa/setup":               authenticated,
+	"POST /api/me/2fa/enable":              authenticated,
+	"POST /api/me/2fa/disable":             authenticated,
+	"POST /api/me/2fa/recovery-codes":      authenticated,
+	"GET /api/audit-events":                adminOnlyAccess,
+	"GET /api/audit-events/export":         adminOnlyAccess,
+	"GET /api/invites":                     adminOnlyAccess,
+	"POST /api/invites":                    adminOnlyAccess,
+	"DELETE /api/invites/:id":              adminOnlyAccess,
+	"GET /api/settings/registration":       adminOnlyAccess,
+	"PUT /api/settings/registration":       adminOnlyAccess,
+	"GET /api/settings/two-factor":         adminOnlyAccess,
+	"PUT /api/settings/two-factor":         adminOnlyAccess,
+	"GET /api/books":                       authenticated,
+	"POST /api/books":                      authenticated,
+	"POST /api/books/lookup":               authenticated,
+	"PUT /api/books/:id":                   ownerOrAdminAccess,
+	"DELETE /api/books/:id":                ownerOrAdminAccess,
+	"PATCH /api/books/:id/loanable":        ownerOrAdminAccess,
+	"POST /api/books/reassign":             adminOnlyAccess,
+	"POST /api/books/borrow":               authenticated,
+	"POST /api/books/return":               authenticated,
+	"GET /api/books/borrowed":              authenticated,
+	"POST /api/books/wish-list":            authenticated,
+	"DELETE /api/books/wish-list/:book_id": authenticated,
+	"GET /api/books/wish-list":             authenticated,
+}
+
+// publicRoutes は認証なしで呼び出せるルート
+var publicRoutes = map[string]bool{
+	"GET /":                               true,
+	"GET /.well-known/jwks.json":          true,
+	"POST /api/login":                     true,
+	"POST /api/login/2fa":                 true,
+	"POST /api/users/register":            true,
+	"POST /api/token/refresh":             true,
+	"POST /api/password/forgot":           true,
+	"POST /api/password/reset":            true,
+	"GET /api/email/verify":               true,
+	"POST /api/email/verification/resend": true,
+	"GET /api/oidc/login":                 true,
+	"POST /api/oidc/callback":             true,
+}
+
+const (
+	testBookID  = 1
+	testOwnerID = 10
+)
+
+type identity struct {
+	name   string
+	userID uint
+	role   schema.Role
+	// scopes が nil でない場合は API キーでの呼び出しとして扱う
+	scopes []schema.APIKeyScope
+}
+
+var (
+	anonymousUser = identity{name: "anonymous"}
+	plainUser     = identity{name: "USER", userID: 20, role: schema.UserRole}
+	ownerUser     = identity{name: "owner", userID: testOwnerID, role: schema.UserRole}
+	nonOwnerUser  = identity{name: "non-owner", userID: 30, role: schema.UserRole}
+	adminUser     = identity{name: "ADMIN", userID: 1, role: schema.AdminRole}
+)
+
+// expectedStatus は access と利用者から期待するステータスコードを返す。
+func expectedStatus(a access, who identity) int {
+	switch {
+	case who.userID == 0:
+		return http.StatusUnauthorized
+	case a == authenticated:
+		return http.StatusOK
+	case who.role == schema.AdminRole:
+		return http.StatusOK
+	case a == ownerOrAdminAccess && who.userID == testOwnerID:
+		return http.StatusOK
+	}
+	return http.StatusForbidden
+}
+
+type memoryTwoFactor struct {
+	required []schema.Role
+	enabled  map[uint]bool
+}
+
+func (m *memoryTwoFactor) RequiredRoles() ([]schema.Role, error) {
+	return m.required, nil
+}
+
+func (m *memoryTwoFactor) IsEnabled(userID uint) (bool, error) {
+	return m.enabled[userID], nil
+}
+
+// stubDependencies は認可の判定で DB を参照する箇所をテスト用の実装に差し替える。
+func stubDependencies(t *testing.T, twoFactor middleware.TwoFactorStore) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("NEXT_PUBLIC_APP_URL", "http://localhost:3000")
+
+	previousTwoFactor, previousFindBookOwnerID := middleware.TwoFactor, findBookOwnerID
+	middleware.TwoFactor = twoFactor
+	findBookOwnerID = func(bookID uint) (uint, error) {
+		if bookID != testBookID {
+			return 0, gorm.ErrRecordNotFound
+		}
+		return testOwnerID, nil
+	}
+	t.Cleanup(func() {
+		middleware.TwoFactor, findBookOwnerID = previousTwoFactor, previousFindBookOwnerID
+	})
+}
+
+// newPolicyTestRouter は GetRouter と同じ保護対象のルートを、JWTAuthMiddleware の代わりに who として
+// ログイン済みにする認証と、何もせず 200 を返すハンドラーで登録する。
+func newPolicyTestRouter(who identity) *gin.Engine {
+	r := gin.New()
+	api := r.Group("/api", func(c *gin.Context) {
+		c.Set("user_id", who.userID)
+		c.Set("role", string(who.role))
+		if who.scopes != nil {
+			c.Set("auth_method", middleware.AuthMethodAPIKey)
+			c.Set("api_key_scopes", who.scopes)
+		} else {
+			c.Set("auth_method", middleware.AuthMethodJWT)
+		}
+		c.Next()
+	}, middleware.EnforcePolicies(routePolicies))
+
+	for _, route := range GetRouter().Routes() {
+		if publicRoutes[route.Method+" "+route.Path] {
+			continue
+		}
+		api.Handle(route.Method, strings.TrimPrefix(route.Path, "/api"), func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{})
+		})
+	}
+	return r
+}
+
+func routeURL(path string) string {
+	path = strings.ReplaceAll(path, ":book_id", "1")
+	return strings.ReplaceAll(path, ":id", "1")
+}
+
+func serve(r *gin.Engine, method, path string) int {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, routeURL(path), nil))
+	return w.Code
+}
+
+func splitRoute(key string) (string, string) {
+	method, path, _ := strings.Cut(key, " ")
+	return method, path
+}
+
+func TestEveryRouteHasPolicyAndExpectation(t *testing.T) {
+	stubDependencies(t, &memoryTwoFactor{})
+
+	for _, route := range GetRouter().Routes() {
+		key := route.Method + " " + route.Path
+		if publicRoutes[key] {
+			continue
+		}
+		if _, ok := routePolicies[key]; !ok {
+			t.Errorf("%s に認可ポリシーがありません", key)
+		}
+		if _, ok := expectedAccess[key]; !ok {
+			t.Errorf("%s の期待する権限がテストにありません", key)
+		}
+	}
+	for key := range routePolicies {
+		if _, ok := expectedAccess[key]; !ok {
+			t.Errorf("routePolicies の %s がテストにありません", key)
+		}
+	}
+}
+
+func TestAnonymousRequestsAreRejected(t *testing.T) {
+	stubDependencies(t, &memoryTwoFactor{})
+	r := GetRouter()
+
+	for key, a := range expectedAccess {
+		method, path := splitRoute(key)
+		want := expectedStatus(a, anonymousUser)
+		if got := serve(r, method, path); got != want {
+			t.Errorf("%s as %s: got %d, want %d", key, anonymousUser.name, got, want)
+		}
+	}
+}
+
+func TestRoutePolicies(t *testing.T) {
+	stubDependencies(t, &memoryTwoFactor{})
+
+	for _, who := range []identity{plainUser, ownerUser, nonOwnerUser, adminUser} {
+		r := newPolicyTestRouter(who)
+		for key, a := range expectedAccess {
+			method, path := splitRoute(key)
+			want := expectedStatus(a, who)
+			if got := serve(r, method, path); got != want {
+				t.Errorf("%s as %s: got %d, want %d", key, who.name, got, want)
+			}
+		}
+	}
+}
+
+func TestOwnerRouteForMissingBook(t *testing.T) {
+	stubDependencies(t, &memoryTwoFactor{})
+	r := newPolicyTestRouter(plainUser)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/books/999", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAdminWithoutRequiredTwoFactor(t *testing.T) {
+	tests := []struct {
+		name      string
+		twoFactor *memoryTwoFactor
+		want      int
+	}{
+		{"not required", &memoryTwoFactor{}, http.StatusOK},
+		{"required and enabled", &memoryTwoFactor{required: []schema.Role{schema.AdminRole}, enabled: map[uint]bool{adminUser.userID: true}}, http.StatusOK},
+		{"required but not enabled", &memoryTwoFactor{required: []schema.Role{schema.AdminRole}}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubDependencies(t, tt.twoFactor)
+			r := newPolicyTestRouter(adminUser)
+			for _, key := range []string{"GET /api/users", "PUT /api/books/:id"} {
+				method, path := splitRoute(key)
+				if got := serve(r, method, path); got != tt.want {
+					t.Errorf("%s: got %d, want %d", key, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	stubDependencies(t, &memoryTwoFactor{})
+
+	tests := []struct {
+		who    identity
+		scopes []schema.APIKeyScope
+		route  string
+		want   int
+	}{
+		{ownerUser, []schema.APIKeyScope{schema.CatalogReadScope}, "GET /api/books", http.StatusOK},
+		{ownerUser, []schema.APIKeyScope{schema.CatalogReadScope}, "POST /api/books", http.StatusForbidden},
+		{ownerUser, []schema.APIKeyScope{schema.BooksWriteScope}, "POST /api/books", http.StatusOK},
+		{ownerUser, []schema.APIKeyScope{schema.BooksWriteScope}, "GET /api/books", http.StatusForbidden},
+		{ownerUser, []schema.APIKeyScope{schema.CatalogReadScope, schema.BooksWriteScope}, "GET /api/me", http.StatusForbidden},
+		{ownerUser, []schema.APIKeyScope{schema.CatalogReadScope, schema.BooksWriteScope}, "POST /api/books/borrow", http.StatusForbidden},
+		{ownerUser, []schema.APIKeyScope{schema.BooksWriteScope}, "PUT /api/books/:id", http.StatusOK},
+		// 管理者の API キーでも他のユーザーの本は操作できない
+		{adminUser, []schema.APIKeyScope{schema.BooksWriteScope}, "PUT /api/books/:id", http.StatusForbidden},
+		{adminUser, []schema.APIKeyScope{schema.BooksWriteScope}, "DELETE /api/books/:id", http.StatusForbidden},
+		{adminUser, []schema.APIKeyScope{schema.BooksWriteScope}, "PATCH /api/books/:id/loanable", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		who := tt.who
+		who.scopes = tt.scopes
+		method, path := splitRoute(tt.route)
+		if got := serve(newPolicyTestRouter(who), method, path); got != tt.want {
+			t.Errorf("%s as %s with scopes %v: got %d, want %d", tt.route, who.name, tt.scopes, got, tt.want)
+		}
+	}
+}
@@ -5,33 +5,84 @@ import (
 	"github.com/sayasurvey/golang/api/controller"
 	"github.com/sayasurvey/golang/middleware"
 	"github.com/gin-contrib/cors"
+	"fmt"
 	"os"
+	"strings"
 )
 
 func GetRouter() *gin.Engine {
 	r := gin.Default()
 
+	// ログイン試行の IP 単位の制限に使うため、X-Forwarded-For は信頼するプロキシからの接続の場合だけ使う
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		fmt.Println("TRUSTED_PROXIES が正しくありません", err)
+		panic("invalid TRUSTED_PROXIES")
+	}
+
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{os.Getenv("NEXT_PUBLIC_APP_URL")},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Type"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "X-API-Key", "X-CSRF-Token"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Type", "Link"},
 		AllowCredentials: true,
 		MaxAge:           12 * 60 * 60,
 	}))
 
 	r.GET("/", controller.SayHello)
+	r.GET("/.well-known/jwks.json", controller.GetJWKS)
 	r.POST("/api/login", controller.Login)
+	r.POST("/api/login/2fa", controller.LoginTwoFactor)
 	r.POST("/api/users/register", controller.Register)
+	r.POST("/api/token/refresh", controller.RefreshToken)
+	r.POST("/api/password/forgot", controller.ForgotPassword)
+	r.POST("/api/password/reset", controller.ResetPassword)
+	r.GET("/api/email/verify", controller.VerifyEmail)
+	r.POST("/api/email/verification/resend", controller.ResendVerificationEmail)
+	r.GET("/api/oidc/login", controller.OIDCLogin)
+	r.POST("/api/oidc/callback", controller.OIDCCallback)
 
-	api := r.Group("/api", middleware.JWTAuthMiddleware())
+	api := r.Group("/api", middleware.JWTAuthMiddleware(), middleware.EnforcePolicies(routePolicies))
 	{
 		api.POST("/logout", controller.Logout)
 		api.GET("/users", controller.GetUsers)
+		api.GET("/users/:id", controller.GetUser)
+		api.PUT("/users/:id/role", controller.UpdateUserRole)
+		api.POST("/users/:id/suspend", controller.SuspendUser)
+		api.POST("/users/:id/reactivate", controller.ReactivateUser)
+		api.POST("/users/:id/password-reset", controller.ForcePasswordReset)
+		api.POST("/users/:id/unlock", controller.UnlockUser)
+		api.DELETE("/users/:id", controller.DeleteUser)
+		api.GET("/directory", controller.GetDirectory)
+		api.GET("/me", controller.GetMe)
+		api.PATCH("/me", controller.UpdateMe)
+		api.DELETE("/me", controller.DeleteMe)
+		api.POST("/me/password", controller.ChangePassword)
+		api.GET("/me/api-keys", controller.GetAPIKeys)
+		api.POST("/me/api-keys", controller.CreateAPIKey)
+		api.DELETE("/me/api-keys/:id", controller.RevokeAPIKey)
+		api.GET("/me/sessions", controller.GetSessions)
+		api.DELETE("/me/sessions", controller.RevokeOtherSessions)
+		api.DELETE("/me/sessions/:id", controller.RevokeSession)
+		api.POST("/me/2fa/setup", controller.SetupTwoFactor)
+		api.POST("/me/2fa/enable", controller.EnableTwoFactor)
+		api.POST("/me/2fa/disable", controller.DisableTwoFactor)
+		api.POST("/me/2fa/recovery-codes", controller.RegenerateRecoveryCodes)
+		api.GET("/audit-events", controller.GetAuditEvents)
+		api.GET("/audit-events/export", controller.ExportAuditEvents)
+		api.GET("/invites", controller.GetInvites)
+		api.POST("/invites", controller.CreateInvite)
+		api.DELETE("/invites/:id", controller.RevokeInvite)
+		api.GET("/settings/registration", controller.GetRegistrationSetting)
+		api.PUT("/settings/registration", controller.UpdateRegistrationSetting)
+		api.GET("/settings/two-factor", controller.GetTwoFactorSetting)
+		api.PUT("/settings/two-factor", controller.UpdateTwoFactorSetting)
 		api.GET("/books", controller.GetBooks)
 		api.POST("/books", controller.CreateBook)
+		api.POST("/books/lookup", controller.LookupBook)
 		api.PUT("/books/:id", controller.UpdateBook)
 		api.DELETE("/books/:id", controller.DeleteBook)
+		api.PATCH("/books/:id/loanable", controller.UpdateBookLoanable)
+		api.POST("/books/reassign", controller.ReassignBookOwners)
 		api.POST("/books/borrow", controller.BorrowBook)
 		api.POST("/books/return", controller.ReturnBook)
 		api.GET("/books/borrowed", controller.GetBorrowedBooks)
@@ -42,3 +93,15 @@ func GetRouter() *gin.Engine {
 
 	return r
 }
+
+// trustedProxies は TRUSTED_PROXIES（カンマ区切りの IP アドレスまたは CIDR）を返す。
+// 未設定の場合は nil を返し、どのプロキシも信頼せず接続元のアドレスをクライアントの IP とする。
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
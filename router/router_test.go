@@ -0,0 +1,40 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPTrustsOnlyConfiguredProxies(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies string
+		want           string
+	}{
+		{"no trusted proxies", "", "192.0.2.1"},
+		{"from a trusted proxy", "192.0.2.0/24, 198.51.100.7", "203.0.113.9"},
+		{"from another address", "198.51.100.7", "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubDependencies(t, &memoryTwoFactor{})
+			t.Setenv("TRUSTED_PROXIES", tt.trustedProxies)
+			r := GetRouter()
+			r.GET("/client-ip", func(c *gin.Context) {
+				c.String(http.StatusOK, c.ClientIP())
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/client-ip", nil)
+			request.RemoteAddr = "192.0.2.1:12345"
+			request.Header.Set("X-Forwarded-For", "203.0.113.9")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}